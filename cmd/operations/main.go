@@ -0,0 +1,165 @@
+// Command operations registers client operations for the persisted query allowlist. It reads every .graphql file
+// under the given paths, validates it against the schema and writes the documents, keyed by their sha256 hash, into
+// a Go file that is compiled into the server.
+//
+//	go run ./cmd/operations -out helpers/persisted/operations_gen.go ../EventMapClient/src/graphql
+//
+// Each file is registered as one document, exactly as the client sends it, so it has to hold every fragment its
+// operations use.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func main() {
+	schemaGlob := flag.String("schema", "graph/*.graphql", "glob matching the server's schema files")
+	out := flag.String("out", "helpers/persisted/operations_gen.go", "Go file to write the registered operations to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: operations [flags] path...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	schema, err := loadSchema(*schemaGlob)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	files, err := findDocuments(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	operations := map[string]string{}
+	failed := false
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		document := string(content)
+
+		query, errs := gqlparser.LoadQuery(schema, document)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Printf("%s: %s", file, err.Message)
+			}
+			failed = true
+			continue
+		}
+		if len(query.Operations) == 0 {
+			continue
+		}
+
+		hash := sha256.Sum256(content)
+		operations[hex.EncodeToString(hash[:])] = document
+
+		names := []string{}
+		for _, operation := range query.Operations {
+			names = append(names, operation.Name)
+		}
+		log.Printf("registered %s: %s", file, strings.Join(names, ", "))
+	}
+
+	if failed {
+		log.Fatal("some operations don't match the schema, nothing was written")
+	}
+
+	if err := write(*out, operations); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d operations to %s", len(operations), *out)
+}
+
+func loadSchema(glob string) (*ast.Schema, error) {
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no schema files match %s", glob)
+	}
+
+	sources := []*ast.Source{}
+	for _, match := range matches {
+		content, err := ioutil.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, &ast.Source{Name: match, Input: string(content)})
+	}
+
+	schema, gqlErr := gqlparser.LoadSchema(sources...)
+	if gqlErr != nil {
+		return nil, gqlErr
+	}
+	return schema, nil
+}
+
+func findDocuments(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".graphql") || strings.HasSuffix(path, ".gql")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func write(out string, operations map[string]string) error {
+	hashes := make([]string, 0, len(operations))
+	for hash := range operations {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by github.com/opaquee/EventMapAPI/cmd/operations, DO NOT EDIT.\n\n")
+	buf.WriteString("package persisted\n\n")
+	buf.WriteString("// Operations maps the sha256 hash of every registered operation document to the document\n")
+	buf.WriteString("var Operations = map[string]string{\n")
+	for _, hash := range hashes {
+		buf.WriteString(strconv.Quote(hash) + ": " + strconv.Quote(operations[hash]) + ",\n")
+	}
+	buf.WriteString("}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(out, source, 0644)
+}
@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+)
+
+func eventConnection(events []*model.Event, pageInfo *model.PageInfo) *model.EventConnection {
+	connection := &model.EventConnection{
+		Edges:    make([]*model.EventEdge, 0, len(events)),
+		PageInfo: pageInfo,
+	}
+
+	for _, event := range events {
+		connection.Edges = append(connection.Edges, &model.EventEdge{
+			Cursor: pagination.Cursor(event.UUIDKey),
+			Node:   event,
+		})
+	}
+	if len(connection.Edges) > 0 {
+		pageInfo.StartCursor = &connection.Edges[0].Cursor
+		pageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+
+	return connection
+}
+
+func userConnection(users []*model.User, pageInfo *model.PageInfo) *model.UserConnection {
+	connection := &model.UserConnection{
+		Edges:    make([]*model.UserEdge, 0, len(users)),
+		PageInfo: pageInfo,
+	}
+
+	for _, user := range users {
+		connection.Edges = append(connection.Edges, &model.UserEdge{
+			Cursor: pagination.Cursor(user.UUIDKey),
+			Node:   user,
+		})
+	}
+	if len(connection.Edges) > 0 {
+		pageInfo.StartCursor = &connection.Edges[0].Cursor
+		pageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+
+	return connection
+}
@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// uniqueViolation is the Postgres error code for inserts that break a unique index
+const uniqueViolation = "23505"
+
+// ErrorPresenter turns resolver errors into the errors clients see. Application errors keep their message and get
+// their code, errors from gqlgen keep theirs, and everything else is logged and replaced by a generic error so
+// database and driver messages never reach clients.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	var appErr *apperrors.Error
+	var gqlErr *gqlerror.Error
+	var pqErr *pq.Error
+
+	switch {
+	case errors.As(err, &appErr):
+		if appErr.Err != nil {
+			logging.For(ctx).Debug("application error", "code", appErr.Code, "error", appErr.Err)
+		}
+		return present(ctx, appErr)
+	case errors.As(err, &gqlErr):
+		return graphql.DefaultErrorPresenter(ctx, gqlErr)
+	case gorm.IsRecordNotFoundError(err):
+		return present(ctx, apperrors.NotFound("record"))
+	case errors.As(err, &pqErr) && pqErr.Code == uniqueViolation:
+		return present(ctx, apperrors.Conflict("record already exists").Wrap(err))
+	case invalidArguments(ctx):
+		//Scalars like UUID and Time report malformed input as plain errors while arguments are unmarshalled
+		return present(ctx, apperrors.Invalid(err.Error()))
+	}
+
+	logging.For(ctx).Error("unexpected resolver error", "error", err, "path", graphql.GetFieldContext(ctx).Path().String())
+	return internal(ctx)
+}
+
+// Recover stops a panicking resolver from taking down the server. The panic and its stack are logged with the
+// request ID, and the client only gets a generic error quoting that ID.
+func Recover(ctx context.Context, recovered interface{}) error {
+	logging.For(ctx).Error("resolver panicked", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+	return internal(ctx)
+}
+
+func present(ctx context.Context, appErr *apperrors.Error) *gqlerror.Error {
+	gqlErr := &gqlerror.Error{
+		Message:    appErr.Message,
+		Path:       graphql.GetFieldContext(ctx).Path(),
+		Extensions: map[string]interface{}{},
+	}
+	for key, value := range appErr.Extensions {
+		gqlErr.Extensions[key] = value
+	}
+	if len(appErr.Fields) > 0 {
+		gqlErr.Extensions["fields"] = fields(appErr.Fields)
+	}
+	errcode.Set(gqlErr, appErr.Code)
+	return gqlErr
+}
+
+// fields maps the dotted path of every invalid input to its problems, like {"input.email": ["must be a valid email address"]}
+func fields(fieldErrors []apperrors.FieldError) map[string][]string {
+	byPath := map[string][]string{}
+	for _, fieldError := range fieldErrors {
+		path := strings.Join(fieldError.Path, ".")
+		byPath[path] = append(byPath[path], fieldError.Message)
+	}
+	return byPath
+}
+
+func internal(ctx context.Context) *gqlerror.Error {
+	gqlErr := &gqlerror.Error{
+		Message:    "internal server error",
+		Path:       graphql.GetFieldContext(ctx).Path(),
+		Extensions: map[string]interface{}{},
+	}
+	if requestID := logging.RequestIDFor(ctx); requestID != "" {
+		gqlErr.Extensions["requestId"] = requestID
+	}
+	errcode.Set(gqlErr, apperrors.CodeInternal)
+	return gqlErr
+}
+
+// invalidArguments reports whether the error came from unmarshalling a field's arguments, which happens before its
+// resolver runs and leaves the field context without them
+func invalidArguments(ctx context.Context) bool {
+	fieldContext := graphql.GetFieldContext(ctx)
+	return fieldContext != nil && fieldContext.Args == nil && len(fieldContext.Field.Arguments) > 0
+}
@@ -0,0 +1,24 @@
+package graph
+
+import (
+	"context"
+	"errors"
+)
+
+// BrokerReady checks the subscription broker isn't stuck by taking its lock before ctx is done. A goroutine left
+// waiting on a stuck lock takes and releases it once it's freed.
+func (r *Resolver) BrokerReady(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		r.MU.Lock()
+		r.MU.Unlock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		return errors.New("subscription broker is unresponsive")
+	}
+}
@@ -0,0 +1,17 @@
+package model
+
+import "github.com/lib/pq"
+
+// PostalAddress is an address in any country. Which fields are required and how they're written depends on the
+// country, see the address helpers.
+type PostalAddress struct {
+	// CountryCode is the ISO 3166-1 alpha-2 code, like US or DE
+	CountryCode string `json:"countryCode"`
+	// PostalCode is a string because postal codes can have letters and leading zeros
+	PostalCode string `json:"postalCode"`
+	// Region is the state, province or prefecture
+	Region string `json:"region"`
+	// Locality is the city or town
+	Locality string         `json:"locality"`
+	Lines    pq.StringArray `json:"lines" gorm:"type:text[]"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CalendarFeed is a secret link calendar apps subscribe to for a user's events. Only a hash of its token is stored,
+// and revoking a feed deletes it.
+type CalendarFeed struct {
+	UUIDKey
+	UserID     uuid.UUID  `json:"userId"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// URL is only known right after the feed is created, while its token is still around
+	URL *string `json:"url" gorm:"-"`
+}
@@ -0,0 +1,7 @@
+package model
+
+type Category struct {
+	UUIDKey
+	Name string `json:"name"`
+	Slug string `json:"slug" gorm:"unique_index"`
+}
@@ -3,22 +3,27 @@ package model
 import (
 	"time"
 
+	"github.com/lib/pq"
 	uuid "github.com/satori/go.uuid"
 )
 
 type Event struct {
 	UUIDKey
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	AddressLine1 string    `json:"addressLine1"`
-	AddressLine2 string    `json:"addressLine2"`
-	City         string    `json:"city"`
-	State        string    `json:"state"`
-	Zip          int       `json:"zip"`
-	Latitude     float64   `json:"latitude"`
-	Longitude    float64   `json:"longitude"`
-	StartDate    time.Time `json:"startDate"`
-	EndDate      time.Time `json:"endDate"`
-	Users        []*User   `json:"users" gorm:"many2many:user_events;"`
-	OwnerID      uuid.UUID `json:"ownerId"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Address     PostalAddress `json:"address" gorm:"embedded;embedded_prefix:address_"`
+	Latitude    float64       `json:"latitude"`
+	Longitude   float64       `json:"longitude"`
+	StartDate   time.Time     `json:"startDate"`
+	EndDate     time.Time     `json:"endDate"`
+	Users       []*User       `json:"users" gorm:"many2many:user_events;"`
+	OwnerID     uuid.UUID     `json:"ownerId"`
+	//Existing rows predate the lifecycle and were already public
+	Status             EventStatus    `json:"status" gorm:"default:'PUBLISHED'"`
+	CancellationReason string         `json:"cancellationReason"`
+	CategoryID         *uuid.UUID     `json:"categoryId" gorm:"type:uuid"`
+	Tags               pq.StringArray `json:"tags" gorm:"type:text[]"`
+	VenueID            *uuid.UUID     `json:"venueId" gorm:"type:uuid"`
+	LocationType       LocationType   `json:"locationType" gorm:"default:'IN_PERSON'"`
+	JoinURL            string         `json:"joinUrl"`
 }
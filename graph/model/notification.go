@@ -0,0 +1,12 @@
+package model
+
+import uuid "github.com/satori/go.uuid"
+
+type Notification struct {
+	UUIDKey
+	UserID  uuid.UUID   `json:"userId"`
+	EventID uuid.UUID   `json:"eventId"`
+	Status  EventStatus `json:"status"`
+	Message string      `json:"message"`
+	Read    bool        `json:"read"`
+}
@@ -10,4 +10,5 @@ type User struct {
 	ProfilePicturePath string   `json:"profilePicturePath"`
 	AttendingEvents    []*Event `json:"attendingEvents" gorm:"many2many:user_events;"`
 	OwnedEvents        []*Event `json:"ownedEvents" gorm:"foreignkey:OwnerID"`
+	IsStaff            bool     `json:"isStaff"`
 }
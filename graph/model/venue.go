@@ -0,0 +1,24 @@
+package model
+
+import uuid "github.com/satori/go.uuid"
+
+// Venue is a place events are held at. Events at a venue copy its address and coordinates, so it only needs
+// geocoding once.
+type Venue struct {
+	UUIDKey
+	Name               string        `json:"name"`
+	Address            PostalAddress `json:"address" gorm:"embedded;embedded_prefix:address_"`
+	Latitude           float64       `json:"latitude"`
+	Longitude          float64       `json:"longitude"`
+	Capacity           *int          `json:"capacity"`
+	AccessibilityNotes string        `json:"accessibilityNotes"`
+	OwnerID            uuid.UUID     `json:"ownerId" gorm:"type:uuid"`
+}
+
+// EventGroup is a spot on the map, with every event held there
+type EventGroup struct {
+	VenueID   *uuid.UUID `json:"venueId"`
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Events    []*Event   `json:"events"`
+}
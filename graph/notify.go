@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+)
+
+// publish sends an event to the newEvents subscribers of its zip code
+func (r *Resolver) publish(event *model.Event) {
+	r.MU.Lock()
+	defer r.MU.Unlock()
+
+	//Subscribers that aren't keeping up miss the event rather than holding up every mutation behind the lock
+	for _, observer := range r.Observers[events.ZipKey(event.Address)] {
+		select {
+		case observer <- event:
+		default:
+		}
+	}
+}
+
+func (r *Resolver) notifyAttendees(ctx context.Context, event *model.Event) error {
+	notifications, err := events.NotifyAttendees(event, r.db(ctx))
+	if err != nil {
+		return err
+	}
+
+	r.MU.Lock()
+	for _, notification := range notifications {
+		//Notifications are stored, so a subscriber that isn't keeping up can fetch them later
+		for _, observer := range r.NotificationObservers[notification.UserID.String()] {
+			select {
+			case observer <- notification:
+			default:
+			}
+		}
+	}
+	r.MU.Unlock()
+
+	return nil
+}
+
+// CompleteEvents periodically marks events that have ended as completed and notifies their attendees
+func (r *Resolver) CompleteEvents(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		completed, err := events.CompletePastEvents(r.DB)
+		if err != nil {
+			logging.For(ctx).Error("completing past events failed", "error", err)
+			continue
+		}
+		for _, event := range completed {
+			if err := r.notifyAttendees(ctx, event); err != nil {
+				logging.For(ctx).Error("notifying attendees failed", "event_id", event.UUIDKey.ID.String(), "error", err)
+			}
+		}
+	}
+}
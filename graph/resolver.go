@@ -1,10 +1,12 @@
 package graph
 
 import (
+	"context"
 	"sync"
 
 	"github.com/jinzhu/gorm"
 	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
 )
 
 //go:generate go run github.com/99designs/gqlgen
@@ -14,7 +16,13 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	MU        sync.Mutex
-	Observers map[int](map[string]chan *model.Event)
-	DB        *gorm.DB
+	MU                    sync.Mutex
+	Observers             map[string](map[string]chan *model.Event)
+	NotificationObservers map[string](map[string]chan *model.Notification)
+	DB                    *gorm.DB
+}
+
+// db is the database handle for a request, which traces its queries as part of the request
+func (r *Resolver) db(ctx context.Context) *gorm.DB {
+	return tracing.WithContext(ctx, r.DB)
 }
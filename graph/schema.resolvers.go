@@ -5,58 +5,160 @@ package graph
 
 import (
 	"context"
-	"errors"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
 	"github.com/opaquee/EventMapAPI/graph/generated"
 	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
 	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/calendars"
+	"github.com/opaquee/EventMapAPI/helpers/categories"
+	"github.com/opaquee/EventMapAPI/helpers/events"
 	"github.com/opaquee/EventMapAPI/helpers/file"
 	"github.com/opaquee/EventMapAPI/helpers/geocode"
 	"github.com/opaquee/EventMapAPI/helpers/jwt"
+	"github.com/opaquee/EventMapAPI/helpers/loaders"
+	"github.com/opaquee/EventMapAPI/helpers/metrics"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	"github.com/opaquee/EventMapAPI/helpers/purge"
+	"github.com/opaquee/EventMapAPI/helpers/search"
 	"github.com/opaquee/EventMapAPI/helpers/users"
+	"github.com/opaquee/EventMapAPI/helpers/validate"
+	"github.com/opaquee/EventMapAPI/helpers/venues"
 	uuid "github.com/satori/go.uuid"
 )
 
+func (r *calendarFeedResolver) ID(ctx context.Context, obj *model.CalendarFeed) (string, error) {
+	return obj.UUIDKey.ID.String(), nil
+}
+
+func (r *categoryResolver) ID(ctx context.Context, obj *model.Category) (string, error) {
+	return obj.UUIDKey.ID.String(), nil
+}
+
 func (r *eventResolver) ID(ctx context.Context, obj *model.Event) (string, error) {
 	return obj.UUIDKey.ID.String(), nil
 }
 
-func (r *eventResolver) Users(ctx context.Context, obj *model.Event) ([]*model.User, error) {
-	var users []*model.User
+func (r *eventResolver) JoinURL(ctx context.Context, obj *model.Event) (*string, error) {
+	//Only the people attending an event get the link to join it
+	canJoin, err := events.CanJoin(auth.ForContext(ctx), obj, loaders.For(ctx, r.db(ctx)).Attending)
+	if err != nil || !canJoin {
+		return nil, err
+	}
+
+	return &obj.JoinURL, nil
+}
+
+func (r *eventResolver) Address(ctx context.Context, obj *model.Event) (*model.PostalAddress, error) {
+	if events.Online(obj) {
+		return nil, nil
+	}
+	return &obj.Address, nil
+}
+
+func (r *eventResolver) AddressLine1(ctx context.Context, obj *model.Event) (string, error) {
+	return address.Line(obj.Address, 0), nil
+}
+
+func (r *eventResolver) AddressLine2(ctx context.Context, obj *model.Event) (string, error) {
+	return address.Line(obj.Address, 1), nil
+}
+
+func (r *eventResolver) City(ctx context.Context, obj *model.Event) (string, error) {
+	return obj.Address.Locality, nil
+}
+
+func (r *eventResolver) State(ctx context.Context, obj *model.Event) (string, error) {
+	return obj.Address.Region, nil
+}
+
+func (r *eventResolver) Zip(ctx context.Context, obj *model.Event) (int, error) {
+	return address.LegacyZip(obj.Address), nil
+}
+
+func (r *eventResolver) Category(ctx context.Context, obj *model.Event) (*model.Category, error) {
+	if obj.CategoryID == nil {
+		return nil, nil
+	}
+
+	category := &model.Category{
+		UUIDKey: model.UUIDKey{
+			ID: *obj.CategoryID,
+		},
+	}
 
-	if err := r.DB.Model(model.Event{
-		UUIDKey: obj.UUIDKey,
-	}).Association("Users").Find(&users).Error; err != nil {
+	if err := r.db(ctx).Where(category).First(category).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
 
-	return users, nil
+	return category, nil
 }
 
-func (r *eventResolver) Owner(ctx context.Context, obj *model.Event) (*model.User, error) {
-	ownerKey := model.UUIDKey{
-		ID: obj.OwnerID,
+func (r *eventResolver) Tags(ctx context.Context, obj *model.Event) ([]string, error) {
+	if obj.Tags == nil {
+		return []string{}, nil
+	}
+	return obj.Tags, nil
+}
+
+func (r *eventResolver) Users(ctx context.Context, obj *model.Event, first *int, after *string, last *int, before *string) (*model.UserConnection, error) {
+	args := pagination.Args{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
 	}
-	owner := &model.User{
-		UUIDKey: ownerKey,
+	page, err := pagination.NewPage(args)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := r.DB.Where(owner).First(owner).Error; err != nil {
+	users, err := loaders.For(ctx, r.db(ctx)).EventUsers(obj.UUIDKey.ID, args)
+	if err != nil {
 		return nil, err
 	}
 
-	return owner, nil
+	return userConnection(users, page.Trim(&users)), nil
+}
+
+func (r *eventResolver) Owner(ctx context.Context, obj *model.Event) (*model.User, error) {
+	return loaders.For(ctx, r.db(ctx)).User(obj.OwnerID)
+}
+
+func (r *eventResolver) Venue(ctx context.Context, obj *model.Event) (*model.Venue, error) {
+	if obj.VenueID == nil {
+		return nil, nil
+	}
+	return loaders.For(ctx, r.db(ctx)).Venue(*obj.VenueID)
+}
+
+func (r *eventGroupResolver) Venue(ctx context.Context, obj *model.EventGroup) (*model.Venue, error) {
+	if obj.VenueID == nil {
+		return nil, nil
+	}
+	return loaders.For(ctx, r.db(ctx)).Venue(*obj.VenueID)
 }
 
 func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser) (string, error) {
+	if err := validate.NewUser(input); err != nil {
+		return "", err
+	}
+
 	if err := users.Duplicate(&model.User{
 		Email:    input.Email,
 		Username: input.Username,
-	}, r.DB); err != nil {
+	}, r.db(ctx)); err != nil {
 		return "", err
 	}
 
@@ -73,7 +175,7 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser)
 		Password:  hashedPassword,
 	}
 
-	if err := r.DB.Create(&user).Error; err != nil {
+	if err := r.db(ctx).Create(&user).Error; err != nil {
 		return "", err
 	}
 
@@ -86,8 +188,12 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser)
 }
 
 func (r *mutationResolver) UpdateUser(ctx context.Context, username string, input model.UpdateUserInput) (*model.User, error) {
+	if err := validate.UpdateUser(input); err != nil {
+		return nil, err
+	}
+
 	userFromCtx := auth.ForContext(ctx)
-	userFromDB, err := users.GetUserByUsername(username, r.DB)
+	userFromDB, err := users.GetUserByUsername(username, r.db(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +206,7 @@ func (r *mutationResolver) UpdateUser(ctx context.Context, username string, inpu
 	if userFromCtx.Email != input.Email {
 		if err := users.Duplicate(&model.User{
 			Email: input.Email,
-		}, r.DB); err != nil {
+		}, r.db(ctx)); err != nil {
 			return nil, err
 		}
 	}
@@ -109,7 +215,7 @@ func (r *mutationResolver) UpdateUser(ctx context.Context, username string, inpu
 	userFromDB.LastName = input.LastName
 	userFromDB.Email = input.Email
 
-	if err := r.DB.Save(userFromDB).Error; err != nil {
+	if err := r.db(ctx).Save(userFromDB).Error; err != nil {
 		return nil, err
 	}
 
@@ -118,7 +224,7 @@ func (r *mutationResolver) UpdateUser(ctx context.Context, username string, inpu
 
 func (r *mutationResolver) DeleteUser(ctx context.Context, username string) (bool, error) {
 	userFromCtx := auth.ForContext(ctx)
-	userFromDB, err := users.GetUserByUsername(username, r.DB)
+	userFromDB, err := users.GetUserByUsername(username, r.db(ctx))
 	if err != nil {
 		return false, err
 	}
@@ -127,39 +233,96 @@ func (r *mutationResolver) DeleteUser(ctx context.Context, username string) (boo
 		return false, err
 	}
 
-	if err := r.DB.Model(model.User{
-		UUIDKey: userFromDB.UUIDKey,
-	}).Association("AttendingEvents").Clear().Error; err != nil {
-		return false, err
-	}
+	//Owned events and venues are deleted at the same moment as the user, so restoring the account can find them again
+	now := time.Now()
+	if err := r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Event{}).Where(&model.Event{
+			OwnerID: userFromDB.UUIDKey.ID,
+		}).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.Venue{}).Where(&model.Venue{
+			OwnerID: userFromDB.UUIDKey.ID,
+		}).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
 
-	if err := r.DB.Unscoped().Delete(&userFromDB).Error; err != nil {
+		return tx.Model(userFromDB).UpdateColumn("deleted_at", now).Error
+	}); err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
 
+func (r *mutationResolver) RestoreAccount(ctx context.Context, input model.Login) (*model.LoginResponse, error) {
+	userFromDB, err := users.GetDeletedUserByUsername(input.Username, r.db(ctx))
+	if err != nil {
+		return nil, apperrors.Forbidden("incorrect username or password")
+	}
+	if users.CheckPasswordHash(input.Password, userFromDB.Password) == false {
+		return nil, apperrors.Forbidden("incorrect username or password")
+	}
+	if purge.Restorable(userFromDB.DeletedAt) == false {
+		return nil, apperrors.Conflict("account can no longer be restored")
+	}
+
+	if err := r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&model.Event{}).Where("owner_id = ? AND deleted_at = ?",
+			userFromDB.UUIDKey.ID,
+			*userFromDB.DeletedAt,
+		).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(&model.Venue{}).Where("owner_id = ? AND deleted_at = ?",
+			userFromDB.UUIDKey.ID,
+			*userFromDB.DeletedAt,
+		).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(userFromDB).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error
+	}); err != nil {
+		return nil, err
+	}
+	userFromDB.DeletedAt = nil
+
+	token, err := jwt.GenerateToken(userFromDB.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginResponse{
+		Token: token,
+		User:  userFromDB,
+	}, nil
+}
+
 func (r *mutationResolver) Login(ctx context.Context, input model.Login) (*model.LoginResponse, error) {
 	user := model.User{
 		Username: input.Username,
 		Password: input.Password,
 	}
 
-	correctLogin, err := users.Authenticate(&user, r.DB)
-	if err != nil {
+	correctLogin, err := users.Authenticate(&user, r.db(ctx))
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		return nil, err
 	}
 	if correctLogin == false {
-		return nil, errors.New("incorrect username or password")
+		metrics.Logins.WithLabelValues("failure").Inc()
+		return nil, apperrors.Forbidden("incorrect username or password")
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
 
 	token, err := jwt.GenerateToken(user.Username)
 	if err != nil {
 		return nil, err
 	}
 
-	userFromDB, err := users.GetUserByUsername(user.Username, r.DB)
+	userFromDB, err := users.GetUserByUsername(user.Username, r.db(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +336,7 @@ func (r *mutationResolver) Login(ctx context.Context, input model.Login) (*model
 func (r *mutationResolver) RefreshToken(ctx context.Context, input model.RefreshTokenInput) (string, error) {
 	username, err := jwt.ParseToken(input.Token)
 	if err != nil {
-		return "", errors.New("access denied")
+		return "", apperrors.Forbidden("access denied")
 	}
 
 	token, err := jwt.GenerateToken(username)
@@ -187,52 +350,78 @@ func (r *mutationResolver) RefreshToken(ctx context.Context, input model.Refresh
 func (r *mutationResolver) CreateEvent(ctx context.Context, input model.NewEvent) (*model.Event, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return nil, errors.New("no user information from context. You probably didn't provide a token")
+		return nil, apperrors.Unauthenticated()
+	}
+	if err := validate.NewEvent(input); err != nil {
+		return nil, err
 	}
 
 	event := model.Event{
 		Name:         input.Name,
 		Description:  input.Description,
-		AddressLine1: input.AddressLine1,
-		AddressLine2: input.AddressLine2,
-		City:         input.City,
-		State:        input.State,
-		Zip:          input.Zip,
+		Address:      events.Address(input),
 		OwnerID:      userFromCtx.ID,
+		Status:       model.EventStatusDraft,
+		LocationType: events.LocationType(input),
+		JoinURL:      events.JoinURL(input),
+	}
+	if input.StartDate != nil {
+		event.StartDate = *input.StartDate
+	}
+	if input.EndDate != nil {
+		event.EndDate = *input.EndDate
 	}
+	if input.CategoryID != nil {
+		category, err := categories.GetCategoryByID(*input.CategoryID, r.db(ctx))
+		if err != nil {
+			return nil, err
+		}
+		event.CategoryID = &category.UUIDKey.ID
+	}
+	event.Tags = events.NormalizeTags(input.Tags)
 
-	//Get latitude and longitude from the geocoding api
-	if err := geocode.GetLatLng(&event); err != nil {
-		return nil, err
+	if input.VenueID != nil {
+		//Events at a venue take its address and coordinates, so there's nothing to geocode
+		venue, err := venues.GetVenueByID(*input.VenueID, r.db(ctx))
+		if err != nil {
+			return nil, err
+		}
+		venues.Apply(&event, venue)
+	} else if input.Location != nil {
+		if err := geocode.GetAddress(ctx, &event, *input.Location); err != nil {
+			return nil, err
+		}
+	} else if !events.Online(&event) {
+		//Get latitude and longitude from the geocoding api. Online events have no address and stay off the map.
+		if err := geocode.GetLatLng(ctx, &event); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := r.DB.Create(&event).Error; err != nil {
+	if err := r.db(ctx).Create(&event).Error; err != nil {
 		return nil, err
 	}
 
-	if err := r.DB.Model(&model.User{
+	if err := r.db(ctx).Model(&model.User{
 		UUIDKey: userFromCtx.UUIDKey,
 	}).Association("OwnedEvents").Append(&event).Error; err != nil {
 		return nil, err
 	}
 
-	r.MU.Lock()
-	for _, observer := range r.Observers[input.Zip] {
-		observer <- &event
-	}
-	r.MU.Unlock()
-
 	return &event, nil
 }
 
 func (r *mutationResolver) UpdateEvent(ctx context.Context, eventID string, input model.NewEvent) (*model.Event, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return nil, errors.New("no user information from context. You probably didn't provide a token")
+		return nil, apperrors.Unauthenticated()
 	}
 
 	id, err := uuid.FromString(eventID)
 	if err != nil {
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
+	}
+	if err := validate.NewEvent(input); err != nil {
 		return nil, err
 	}
 	oldEvent := &model.Event{
@@ -241,48 +430,79 @@ func (r *mutationResolver) UpdateEvent(ctx context.Context, eventID string, inpu
 		},
 	}
 
-	if err := users.CheckEventOwner(userFromCtx, oldEvent, r.DB); err != nil {
+	if err := users.CheckEventOwner(userFromCtx, oldEvent, r.db(ctx)); err != nil {
 		return nil, err
 	}
 
 	newEvent := model.Event{
-		Name:         input.Name,
-		Description:  input.Description,
-		AddressLine1: input.AddressLine1,
-		AddressLine2: input.AddressLine2,
-		City:         input.City,
-		State:        input.State,
-		Zip:          input.Zip,
-		Latitude:     oldEvent.Latitude,
-		Longitude:    oldEvent.Longitude,
-		OwnerID:      userFromCtx.UUIDKey.ID,
+		Name:               input.Name,
+		Description:        input.Description,
+		Address:            events.Address(input),
+		Latitude:           oldEvent.Latitude,
+		Longitude:          oldEvent.Longitude,
+		StartDate:          oldEvent.StartDate,
+		EndDate:            oldEvent.EndDate,
+		OwnerID:            userFromCtx.UUIDKey.ID,
+		Status:             oldEvent.Status,
+		CancellationReason: oldEvent.CancellationReason,
+		CategoryID:         oldEvent.CategoryID,
+		Tags:               oldEvent.Tags,
+		VenueID:            oldEvent.VenueID,
+		LocationType:       events.LocationType(input),
+		JoinURL:            events.JoinURL(input),
+	}
+	if input.StartDate != nil {
+		newEvent.StartDate = *input.StartDate
+	}
+	if input.EndDate != nil {
+		newEvent.EndDate = *input.EndDate
+	}
+	addressChanged := address.Query(oldEvent.Address) != address.Query(newEvent.Address) ||
+		oldEvent.Address.CountryCode != newEvent.Address.CountryCode
+	//Events stay at their venue until they're given somewhere else to be held
+	if input.Location != nil || addressChanged || events.Online(&newEvent) {
+		newEvent.VenueID = nil
+	}
+	if input.CategoryID != nil {
+		category, err := categories.GetCategoryByID(*input.CategoryID, r.db(ctx))
+		if err != nil {
+			return nil, err
+		}
+		newEvent.CategoryID = &category.UUIDKey.ID
 	}
-
-	id, err = uuid.FromString(eventID)
-	if err != nil {
-		return nil, err
+	if input.Tags != nil {
+		newEvent.Tags = events.NormalizeTags(input.Tags)
 	}
+
 	newEvent.UUIDKey.ID = id
 
-	//If address is new, get latitude and longitude from the geocoding api
-	if oldEvent.AddressLine1 != newEvent.AddressLine1 ||
-		oldEvent.City != newEvent.City ||
-		oldEvent.State != newEvent.State ||
-		oldEvent.Zip != newEvent.Zip {
-		if err := geocode.GetLatLng(&newEvent); err != nil {
+	if input.VenueID != nil {
+		venue, err := venues.GetVenueByID(*input.VenueID, r.db(ctx))
+		if err != nil {
+			return nil, err
+		}
+		venues.Apply(&newEvent, venue)
+	} else if input.Location != nil {
+		if err := geocode.GetAddress(ctx, &newEvent, *input.Location); err != nil {
+			return nil, err
+		}
+	} else if events.Online(&newEvent) {
+		newEvent.Latitude = 0
+		newEvent.Longitude = 0
+	} else if addressChanged {
+		//If address is new, get latitude and longitude from the geocoding api
+		if err := geocode.GetLatLng(ctx, &newEvent); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := r.DB.Save(&newEvent).Error; err != nil {
+	if err := r.db(ctx).Save(&newEvent).Error; err != nil {
 		return nil, err
 	}
 
-	r.MU.Lock()
-	for _, observer := range r.Observers[input.Zip] {
-		observer <- &newEvent
+	if newEvent.Status != model.EventStatusDraft {
+		r.publish(&newEvent)
 	}
-	r.MU.Unlock()
 
 	return &newEvent, nil
 }
@@ -290,12 +510,12 @@ func (r *mutationResolver) UpdateEvent(ctx context.Context, eventID string, inpu
 func (r *mutationResolver) DeleteEvent(ctx context.Context, eventID string) (bool, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return false, errors.New("no user information from context. You probably didn't provide a token")
+		return false, apperrors.Unauthenticated()
 	}
 
 	id, err := uuid.FromString(eventID)
 	if err != nil {
-		return false, err
+		return false, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
 	}
 	UUIDKey := model.UUIDKey{
 		ID: id,
@@ -304,17 +524,11 @@ func (r *mutationResolver) DeleteEvent(ctx context.Context, eventID string) (boo
 		UUIDKey: UUIDKey,
 	}
 
-	if err := users.CheckEventOwner(userFromCtx, event, r.DB); err != nil {
-		return false, err
-	}
-
-	if err := r.DB.Model(model.Event{
-		UUIDKey: UUIDKey,
-	}).Association("Users").Clear().Error; err != nil {
+	if err := users.CheckEventOwner(userFromCtx, event, r.db(ctx)); err != nil {
 		return false, err
 	}
 
-	if err := r.DB.Unscoped().Delete(&model.Event{
+	if err := r.db(ctx).Delete(&model.Event{
 		UUIDKey: UUIDKey,
 	}).Error; err != nil {
 		return false, err
@@ -323,231 +537,966 @@ func (r *mutationResolver) DeleteEvent(ctx context.Context, eventID string) (boo
 	return true, nil
 }
 
-func (r *mutationResolver) AddUserProfilePicture(ctx context.Context, profilePicture graphql.Upload) (bool, error) {
+func (r *mutationResolver) RestoreEvent(ctx context.Context, eventID string) (*model.Event, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return false, errors.New("no user information from context. You probably didn't provide a token")
+		return nil, apperrors.Unauthenticated()
 	}
 
-	if valid, err := file.ValidImageFile(profilePicture.Filename); err != nil || valid == false {
-		return false, errors.New("Invalid image file")
-	}
-	content, err := ioutil.ReadAll(profilePicture.File)
+	id, err := uuid.FromString(eventID)
 	if err != nil {
-		return false, err
-	}
-
-	filePath := os.Getenv("APP_VOLUME") + file.NewFileName(profilePicture.Filename, userFromCtx)
-	if _, err := os.Create(filePath); err != nil {
-		return false, err
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
 	}
-	if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
-		return false, err
+	event := &model.Event{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
 	}
 
-	userFromDB, err := users.GetUserByUsername(userFromCtx.Username, r.DB)
-	if err != nil {
-		return false, err
-	}
-	userFromDB.ProfilePicturePath = filePath
-	if err := r.DB.Save(userFromDB).Error; err != nil {
-		return false, err
+	if err := users.CheckEventOwner(userFromCtx, event, r.db(ctx).Unscoped()); err != nil {
+		return nil, err
 	}
-
-	return true, nil
-}
-
-func (r *mutationResolver) RemoveUserProfilePicture(ctx context.Context) (bool, error) {
-	userFromCtx := auth.ForContext(ctx)
-	if userFromCtx == nil {
-		return false, errors.New("no user information from context. You probably didn't provide a token")
+	if event.DeletedAt == nil {
+		return nil, apperrors.Conflict("event is not deleted")
 	}
-
-	splitPath := strings.Split(userFromCtx.ProfilePicturePath, ".")
-	if splitPath[0] != os.Getenv("APP_VOLUME")+userFromCtx.UUIDKey.ID.String() {
-		return false, errors.New("Access denied, can't delete file at specified path")
+	if purge.Restorable(event.DeletedAt) == false {
+		return nil, apperrors.Conflict("event can no longer be restored")
 	}
 
-	if err := os.Remove(userFromCtx.ProfilePicturePath); err != nil {
-		return false, err
+	if err := r.db(ctx).Unscoped().Model(event).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error; err != nil {
+		return nil, err
 	}
+	event.DeletedAt = nil
 
-	return true, nil
+	return event, nil
 }
 
-func (r *mutationResolver) AddUserToEvent(ctx context.Context, eventID string) (bool, error) {
+func (r *mutationResolver) PublishEvent(ctx context.Context, eventID string) (*model.Event, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return false, errors.New("no user information from context. You probably didn't provide a token")
+		return nil, apperrors.Unauthenticated()
 	}
 
 	id, err := uuid.FromString(eventID)
 	if err != nil {
-		return false, err
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
 	}
-	r.DB.Model(userFromCtx).Association("AttendingEvents").Append(&model.Event{
+	event := &model.Event{
 		UUIDKey: model.UUIDKey{
 			ID: id,
 		},
-	})
+	}
 
-	return true, nil
+	if err := users.CheckEventOwner(userFromCtx, event, r.db(ctx)); err != nil {
+		return nil, err
+	}
+
+	wasDraft := event.Status == model.EventStatusDraft
+	if err := events.Transition(event, model.EventStatusPublished); err != nil {
+		return nil, err
+	}
+
+	if err := r.db(ctx).Save(event).Error; err != nil {
+		return nil, err
+	}
+
+	if wasDraft {
+		r.publish(event)
+	} else if err := r.notifyAttendees(ctx, event); err != nil {
+		return nil, err
+	}
+
+	return event, nil
 }
 
-func (r *mutationResolver) RemoveUserFromEvent(ctx context.Context, eventID string) (bool, error) {
+func (r *mutationResolver) CancelEvent(ctx context.Context, eventID string, reason string) (*model.Event, error) {
 	userFromCtx := auth.ForContext(ctx)
 	if userFromCtx == nil {
-		return false, errors.New("no user information from context. You probably didn't provide a token")
+		return nil, apperrors.Unauthenticated()
 	}
 
 	id, err := uuid.FromString(eventID)
 	if err != nil {
-		return false, err
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
 	}
-	r.DB.Model(userFromCtx).Association("AttendingEvents").Delete(&model.Event{
+	event := &model.Event{
 		UUIDKey: model.UUIDKey{
 			ID: id,
 		},
-	})
-
-	return true, nil
-}
-
-func (r *queryResolver) GetAllNearbyEvents(ctx context.Context, zip int) ([]*model.Event, error) {
-	var nearbyEvents []*model.Event
+	}
 
-	if err := r.DB.Where(&model.Event{
-		Zip: zip,
-	}).Find(&nearbyEvents).Error; err != nil {
+	if err := users.CheckEventOwner(userFromCtx, event, r.db(ctx)); err != nil {
 		return nil, err
 	}
 
-	return nearbyEvents, nil
-}
-
-func (r *queryResolver) GetEventByID(ctx context.Context, eventID string) (*model.Event, error) {
-	id, err := uuid.FromString(eventID)
-	if err != nil {
+	if err := events.Transition(event, model.EventStatusCancelled); err != nil {
 		return nil, err
 	}
-	eventFromDB := model.Event{
-		UUIDKey: model.UUIDKey{
-			ID: id,
-		},
+	event.CancellationReason = reason
+
+	if err := r.db(ctx).Save(event).Error; err != nil {
+		return nil, err
 	}
 
-	if err := r.DB.Where(&eventFromDB).First(&eventFromDB).Error; err != nil {
+	if err := r.notifyAttendees(ctx, event); err != nil {
 		return nil, err
 	}
 
-	return &eventFromDB, nil
+	return event, nil
 }
 
-func (r *queryResolver) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
-	id, err := uuid.FromString(userID)
+func (r *mutationResolver) PostponeEvent(ctx context.Context, eventID string, newStart time.Time) (*model.Event, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+
+	id, err := uuid.FromString(eventID)
 	if err != nil {
-		return nil, err
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
 	}
-	userFromDB := model.User{
+	event := &model.Event{
 		UUIDKey: model.UUIDKey{
 			ID: id,
 		},
 	}
 
-	if err := r.DB.Where(&userFromDB).First(&userFromDB).Error; err != nil {
+	if err := users.CheckEventOwner(userFromCtx, event, r.db(ctx)); err != nil {
 		return nil, err
 	}
 
-	return &userFromDB, nil
-}
-
-func (r *subscriptionResolver) NewEvents(ctx context.Context, zip int, userID string) (<-chan *model.Event, error) {
-	observer := make(chan *model.Event, 1)
+	if !newStart.After(time.Now()) {
+		return nil, apperrors.Validation(apperrors.Field("has to be in the future", "newStart"))
+	}
 
-	//Cleanup empty observer channels
-	go func() {
-		<-ctx.Done()
-		r.MU.Lock()
-		delete(r.Observers[zip], userID)
-		if len(r.Observers[zip]) == 0 {
-			delete(r.Observers, zip)
-		}
-		r.MU.Unlock()
-	}()
+	if err := events.Transition(event, model.EventStatusPostponed); err != nil {
+		return nil, err
+	}
 
-	r.MU.Lock()
-	if r.Observers[zip] == nil {
-		localObservers := make(map[string]chan *model.Event, 1)
-		r.Observers[zip] = localObservers
+	//Keep the event's length when moving it
+	if !event.EndDate.IsZero() {
+		event.EndDate = newStart.Add(event.EndDate.Sub(event.StartDate))
 	}
-	r.Observers[zip][userID] = observer
-	r.MU.Unlock()
+	event.StartDate = newStart
 
-	return observer, nil
-}
+	if err := r.db(ctx).Save(event).Error; err != nil {
+		return nil, err
+	}
 
-func (r *userResolver) ID(ctx context.Context, obj *model.User) (string, error) {
-	return obj.UUIDKey.ID.String(), nil
-}
+	if err := r.notifyAttendees(ctx, event); err != nil {
+		return nil, err
+	}
 
-func (r *userResolver) Email(ctx context.Context, obj *model.User) (string, error) {
-	return "", errors.New("access denied, email is private to user")
+	return event, nil
 }
 
-func (r *userResolver) Password(ctx context.Context, obj *model.User) (string, error) {
-	return "", errors.New("access denied, password is private to user")
-}
+func (r *mutationResolver) CreateCategory(ctx context.Context, name string) (*model.Category, error) {
+	if err := users.CheckStaff(auth.ForContext(ctx)); err != nil {
+		return nil, err
+	}
 
-func (r *userResolver) ProfilePicture(ctx context.Context, obj *model.User) (*model.File, error) {
-	userFromCtx := auth.ForContext(ctx)
-	if userFromCtx == nil {
-		return nil, errors.New("no user information from context. You probably didn't provide a token")
+	category := model.Category{
+		Name: strings.TrimSpace(name),
+		Slug: categories.Slug(name),
+	}
+	if category.Slug == "" {
+		return nil, apperrors.Validation(apperrors.Field("can't be empty", "name"))
 	}
 
-	fileBytes, err := ioutil.ReadFile(userFromCtx.ProfilePicturePath)
-	if err != nil {
+	if err := categories.Duplicate(&category, r.db(ctx)); err != nil {
 		return nil, err
 	}
 
-	ext := strings.Split(userFromCtx.ProfilePicturePath, ".")[1]
+	if err := r.db(ctx).Create(&category).Error; err != nil {
+		return nil, err
+	}
 
-	return &model.File{
-		Name:        userFromCtx.Username + "." + ext,
-		Content:     string(fileBytes),
-		ContentType: "image/" + ext,
-	}, nil
+	return &category, nil
 }
 
-func (r *userResolver) AttendingEvents(ctx context.Context, obj *model.User) ([]*model.Event, error) {
-	var attendingEvents []*model.Event
+func (r *mutationResolver) UpdateCategory(ctx context.Context, categoryID string, name string) (*model.Category, error) {
+	if err := users.CheckStaff(auth.ForContext(ctx)); err != nil {
+		return nil, err
+	}
 
-	if err := r.DB.Model(model.User{
-		UUIDKey: obj.UUIDKey,
-	}).Association("AttendingEvents").Find(&attendingEvents).Error; err != nil {
+	category, err := categories.GetCategoryByID(categoryID, r.db(ctx))
+	if err != nil {
 		return nil, err
 	}
 
-	return attendingEvents, nil
-}
+	category.Name = strings.TrimSpace(name)
+	category.Slug = categories.Slug(name)
+	if category.Slug == "" {
+		return nil, apperrors.Validation(apperrors.Field("can't be empty", "name"))
+	}
 
-func (r *userResolver) OwnedEvents(ctx context.Context, obj *model.User) ([]*model.Event, error) {
-	var ownedEvents []*model.Event
+	if err := categories.Duplicate(category, r.db(ctx)); err != nil {
+		return nil, err
+	}
 
-	if err := r.DB.Model(model.User{
-		UUIDKey: obj.UUIDKey,
-	}).Association("OwnedEvents").Find(&ownedEvents).Error; err != nil {
+	if err := r.db(ctx).Save(category).Error; err != nil {
 		return nil, err
 	}
 
-	return ownedEvents, nil
+	return category, nil
 }
 
+func (r *mutationResolver) DeleteCategory(ctx context.Context, categoryID string) (bool, error) {
+	if err := users.CheckStaff(auth.ForContext(ctx)); err != nil {
+		return false, err
+	}
+
+	category, err := categories.GetCategoryByID(categoryID, r.db(ctx))
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&model.Event{}).Where(&model.Event{
+			CategoryID: &category.UUIDKey.ID,
+		}).UpdateColumn("category_id", gorm.Expr("NULL")).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(category).Error
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateVenue(ctx context.Context, input model.NewVenue) (*model.Venue, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+	if err := validate.NewVenue(input); err != nil {
+		return nil, err
+	}
+
+	venue := model.Venue{
+		Name:     strings.TrimSpace(input.Name),
+		Address:  address.FromInput(*input.Address),
+		Capacity: input.Capacity,
+		OwnerID:  userFromCtx.UUIDKey.ID,
+	}
+	if input.AccessibilityNotes != nil {
+		venue.AccessibilityNotes = strings.TrimSpace(*input.AccessibilityNotes)
+	}
+
+	latitude, longitude, err := geocode.Locate(ctx, venue.Address)
+	if err != nil {
+		return nil, err
+	}
+	venue.Latitude = latitude
+	venue.Longitude = longitude
+
+	if err := r.db(ctx).Create(&venue).Error; err != nil {
+		return nil, err
+	}
+
+	return &venue, nil
+}
+
+func (r *mutationResolver) UpdateVenue(ctx context.Context, venueID string, input model.NewVenue) (*model.Venue, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+	if err := validate.NewVenue(input); err != nil {
+		return nil, err
+	}
+
+	venue, err := venues.GetVenueByID(venueID, r.db(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := venues.CheckOwner(userFromCtx, venue); err != nil {
+		return nil, err
+	}
+
+	newAddress := address.FromInput(*input.Address)
+	moved := address.Query(venue.Address) != address.Query(newAddress) ||
+		venue.Address.CountryCode != newAddress.CountryCode
+	if moved {
+		latitude, longitude, err := geocode.Locate(ctx, newAddress)
+		if err != nil {
+			return nil, err
+		}
+		venue.Latitude = latitude
+		venue.Longitude = longitude
+	}
+
+	venue.Name = strings.TrimSpace(input.Name)
+	venue.Address = newAddress
+	venue.Capacity = input.Capacity
+	venue.AccessibilityNotes = ""
+	if input.AccessibilityNotes != nil {
+		venue.AccessibilityNotes = strings.TrimSpace(*input.AccessibilityNotes)
+	}
+
+	if err := r.db(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(venue).Error; err != nil {
+			return err
+		}
+		if moved {
+			return venues.Moved(venue, tx)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return venue, nil
+}
+
+func (r *mutationResolver) DeleteVenue(ctx context.Context, venueID string) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	venue, err := venues.GetVenueByID(venueID, r.db(ctx))
+	if err != nil {
+		return false, err
+	}
+	if err := venues.CheckOwner(userFromCtx, venue); err != nil {
+		return false, err
+	}
+
+	//Events held there keep the address they copied
+	if err := r.db(ctx).Delete(venue).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) AddUserProfilePicture(ctx context.Context, profilePicture graphql.Upload) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	if valid, err := file.ValidImageFile(profilePicture.Filename); err != nil || valid == false {
+		return false, apperrors.Validation(apperrors.Field("isn't a supported image file", "profilePicture"))
+	}
+	content, err := ioutil.ReadAll(profilePicture.File)
+	if err != nil {
+		return false, err
+	}
+
+	filePath := file.Path(file.NewFileName(profilePicture.Filename, userFromCtx))
+	if _, err := os.Create(filePath); err != nil {
+		return false, err
+	}
+	if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+		return false, err
+	}
+
+	userFromDB, err := users.GetUserByUsername(userFromCtx.Username, r.db(ctx))
+	if err != nil {
+		return false, err
+	}
+	userFromDB.ProfilePicturePath = filePath
+	if err := r.db(ctx).Save(userFromDB).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RemoveUserProfilePicture(ctx context.Context) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	splitPath := strings.Split(userFromCtx.ProfilePicturePath, ".")
+	if splitPath[0] != file.Path(userFromCtx.UUIDKey.ID.String()) {
+		return false, apperrors.Forbidden("access denied, can't delete file at specified path")
+	}
+
+	if err := os.Remove(userFromCtx.ProfilePicturePath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) AddUserToEvent(ctx context.Context, eventID string) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return false, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
+	}
+	event := &model.Event{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	}
+
+	if err := r.db(ctx).Where(event).First(event).Error; err != nil {
+		return false, err
+	}
+	if event.Status != model.EventStatusPublished && event.Status != model.EventStatusPostponed {
+		return false, apperrors.Conflict("event is not open for attendance")
+	}
+
+	r.db(ctx).Model(userFromCtx).Association("AttendingEvents").Append(event)
+
+	return true, nil
+}
+
+func (r *mutationResolver) RemoveUserFromEvent(ctx context.Context, eventID string) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return false, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
+	}
+	r.db(ctx).Model(userFromCtx).Association("AttendingEvents").Delete(&model.Event{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	})
+
+	return true, nil
+}
+
+func (r *mutationResolver) MarkNotificationRead(ctx context.Context, notificationID string) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	id, err := uuid.FromString(notificationID)
+	if err != nil {
+		return false, apperrors.Validation(apperrors.Field("isn't a valid id", "notificationId"))
+	}
+
+	result := r.db(ctx).Model(&model.Notification{}).Where(&model.Notification{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+		UserID: userFromCtx.UUIDKey.ID,
+	}).Update("read", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, apperrors.NotFound("notification")
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateCalendarFeed(ctx context.Context, name string) (*model.CalendarFeed, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+
+	v := &validate.Validator{}
+	v.Length(name, 1, validate.MaxNameLength, "name")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return calendars.Create(r.db(ctx), userFromCtx, strings.TrimSpace(name))
+}
+
+func (r *mutationResolver) RevokeCalendarFeed(ctx context.Context, feedID string) (bool, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return false, apperrors.Unauthenticated()
+	}
+
+	feed, err := calendars.GetFeedByID(feedID, userFromCtx, r.db(ctx))
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.db(ctx).Delete(feed).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *notificationResolver) ID(ctx context.Context, obj *model.Notification) (string, error) {
+	return obj.UUIDKey.ID.String(), nil
+}
+
+func (r *notificationResolver) Event(ctx context.Context, obj *model.Notification) (*model.Event, error) {
+	event := &model.Event{
+		UUIDKey: model.UUIDKey{
+			ID: obj.EventID,
+		},
+	}
+
+	//Notifications outlive the soft deleted events they're about until the purge job removes both
+	if err := r.db(ctx).Unscoped().Where(event).First(event).Error; err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func (r *postalAddressResolver) Lines(ctx context.Context, obj *model.PostalAddress) ([]string, error) {
+	return obj.Lines, nil
+}
+
+func (r *postalAddressResolver) Formatted(ctx context.Context, obj *model.PostalAddress) (string, error) {
+	return address.Format(*obj), nil
+}
+
+func (r *queryResolver) GetAllNearbyEvents(ctx context.Context, zip int, includeCancelled *bool, includeOnline *bool, filter *model.EventFilter, first *int, after *string, last *int, before *string) (*model.EventConnection, error) {
+	v := &validate.Validator{}
+	v.Zip(zip, "zip")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var nearbyEvents []*model.Event
+
+	query, page, err := pagination.Paginate(events.Visible(r.db(ctx), auth.ForContext(ctx), includeCancelled != nil && *includeCancelled), "events", pagination.Args{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = events.Filtered(events.InZip(query, zip, includeOnline != nil && *includeOnline), filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Find(&nearbyEvents).Error; err != nil {
+		return nil, err
+	}
+
+	return eventConnection(nearbyEvents, page.Trim(&nearbyEvents)), nil
+}
+
+func (r *queryResolver) GetEventsInViewport(ctx context.Context, bounds model.BoundsInput, includeCancelled *bool, includeOnline *bool, filter *model.EventFilter) ([]*model.Event, error) {
+	var viewportEvents []*model.Event
+
+	query := events.Visible(r.db(ctx), auth.ForContext(ctx), includeCancelled != nil && *includeCancelled)
+	query, err := events.Filtered(events.InBounds(query, &bounds, includeOnline != nil && *includeOnline), filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Order("events.start_date").Limit(events.MaxInViewport).Find(&viewportEvents).Error; err != nil {
+		return nil, err
+	}
+
+	return viewportEvents, nil
+}
+
+func (r *queryResolver) GetEventGroupsInViewport(ctx context.Context, bounds model.BoundsInput, includeCancelled *bool, filter *model.EventFilter) ([]*model.EventGroup, error) {
+	var viewportEvents []*model.Event
+
+	query := events.Visible(r.db(ctx), auth.ForContext(ctx), includeCancelled != nil && *includeCancelled)
+	query, err := events.Filtered(events.InBounds(query, &bounds, false), filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Order("events.start_date").Limit(events.MaxInViewport).Find(&viewportEvents).Error; err != nil {
+		return nil, err
+	}
+
+	return venues.Group(viewportEvents), nil
+}
+
+func (r *queryResolver) GetEventFacets(ctx context.Context, zip *int, bounds *model.BoundsInput, includeCancelled *bool, includeOnline *bool, filter *model.EventFilter) (*model.EventFacets, error) {
+	if (zip == nil) == (bounds == nil) {
+		return nil, apperrors.Invalid("provide either a zip or bounds")
+	}
+	if zip != nil {
+		v := &validate.Validator{}
+		v.Zip(*zip, "zip")
+		if err := v.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	query := events.Visible(r.db(ctx), auth.ForContext(ctx), includeCancelled != nil && *includeCancelled)
+	if zip != nil {
+		query = events.InZip(query, *zip, includeOnline != nil && *includeOnline)
+	} else {
+		query = events.InBounds(query, bounds, includeOnline != nil && *includeOnline)
+	}
+
+	return events.Facets(query, filter)
+}
+
+func (r *queryResolver) GetCategories(ctx context.Context) ([]*model.Category, error) {
+	allCategories := []*model.Category{}
+
+	if err := r.db(ctx).Order("name").Find(&allCategories).Error; err != nil {
+		return nil, err
+	}
+
+	return allCategories, nil
+}
+
+func (r *queryResolver) Venue(ctx context.Context, venueID string) (*model.Venue, error) {
+	return venues.GetVenueByID(venueID, r.db(ctx))
+}
+
+func (r *queryResolver) Venues(ctx context.Context, near model.LocationInput, radiusKm *float64, first *int) ([]*model.Venue, error) {
+	radius := venues.DefaultRadiusKm
+	if radiusKm != nil {
+		radius = *radiusKm
+	}
+	limit := pagination.DefaultPageSize
+	if first != nil {
+		limit = *first
+	}
+
+	v := &validate.Validator{}
+	v.Location(near, "near")
+	v.Check(radius > 0 && radius <= venues.MaxRadiusKm, "must be more than 0 and at most "+strconv.Itoa(venues.MaxRadiusKm), "radiusKm")
+	v.Check(limit >= 1 && limit <= pagination.MaxPageSize(), "must be between 1 and "+strconv.Itoa(pagination.MaxPageSize()), "first")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return venues.Near(r.db(ctx), near, radius, limit)
+}
+
+func (r *queryResolver) ReverseGeocode(ctx context.Context, latitude float64, longitude float64) (*model.PostalAddress, error) {
+	v := &validate.Validator{}
+	v.Location(model.LocationInput{Latitude: latitude, Longitude: longitude})
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return geocode.Reverse(ctx, latitude, longitude)
+}
+
+func (r *queryResolver) AddressSuggestions(ctx context.Context, prefix string, near *model.LocationInput, first *int) ([]*model.AddressSuggestion, error) {
+	limit := geocode.DefaultSuggestions
+	if first != nil {
+		limit = *first
+	}
+
+	v := &validate.Validator{}
+	v.Length(prefix, geocode.MinPrefixLength, validate.MaxAddressLength, "prefix")
+	if near != nil {
+		v.Location(*near, "near")
+	}
+	v.Check(limit >= 1 && limit <= geocode.MaxSuggestions, "must be between 1 and "+strconv.Itoa(geocode.MaxSuggestions), "first")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return geocode.Suggest(ctx, prefix, near, limit)
+}
+
+func (r *queryResolver) SearchEvents(ctx context.Context, query string, near *model.LocationInput, radiusKm *float64, includeCancelled *bool, includeOnline *bool, from *time.Time, to *time.Time, categories []string, first *int, after *string) (*model.EventSearchResults, error) {
+	params := search.Params{
+		Text:          query,
+		Near:          near,
+		RadiusKm:      radiusKm,
+		IncludeOnline: includeOnline != nil && *includeOnline,
+		From:          from,
+		To:            to,
+		CategoryIDs:   categories,
+	}
+	if first != nil {
+		params.First = *first
+	}
+	if after != nil {
+		params.After = *after
+	}
+
+	hits, offset, hasNextPage, err := search.Events(events.Visible(r.db(ctx), auth.ForContext(ctx), includeCancelled != nil && *includeCancelled), params)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &model.EventSearchResults{
+		Results:     make([]*model.EventSearchResult, 0, len(hits)),
+		HasNextPage: hasNextPage,
+	}
+	for i, hit := range hits {
+		event := hit.Event
+		results.Results = append(results.Results, &model.EventSearchResult{
+			Event:      &event,
+			Rank:       hit.Rank,
+			DistanceKm: hit.DistanceKm,
+			Snippet:    hit.Snippet,
+			Cursor:     search.EncodeCursor(offset + i + 1),
+		})
+	}
+	if len(results.Results) > 0 {
+		results.EndCursor = &results.Results[len(results.Results)-1].Cursor
+	}
+
+	return results, nil
+}
+
+func (r *queryResolver) GetEventByID(ctx context.Context, eventID string) (*model.Event, error) {
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "eventId"))
+	}
+	eventFromDB := model.Event{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	}
+
+	if err := r.db(ctx).Where(&eventFromDB).First(&eventFromDB).Error; err != nil {
+		return nil, err
+	}
+
+	if !events.CanView(auth.ForContext(ctx), &eventFromDB) {
+		return nil, apperrors.NotFound("event")
+	}
+
+	return &eventFromDB, nil
+}
+
+func (r *queryResolver) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	id, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "userId"))
+	}
+	userFromDB := model.User{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	}
+
+	if err := r.db(ctx).Where(&userFromDB).First(&userFromDB).Error; err != nil {
+		return nil, err
+	}
+
+	return &userFromDB, nil
+}
+
+func (r *queryResolver) GetNotifications(ctx context.Context, unreadOnly *bool) ([]*model.Notification, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+
+	var notifications []*model.Notification
+
+	query := r.db(ctx).Where(&model.Notification{
+		UserID: userFromCtx.UUIDKey.ID,
+	})
+	if unreadOnly != nil && *unreadOnly {
+		query = query.Where("read = ?", false)
+	}
+
+	if err := query.Order("created_at desc").Limit(events.MaxNotifications).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (r *queryResolver) CalendarFeeds(ctx context.Context) ([]*model.CalendarFeed, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+
+	feeds := []*model.CalendarFeed{}
+	if err := r.db(ctx).Where("user_id = ?", userFromCtx.UUIDKey.ID).Order("created_at").Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+func (r *subscriptionResolver) NewEvents(ctx context.Context, zip int, userID string) (<-chan *model.Event, error) {
+	v := &validate.Validator{}
+	v.Zip(zip, "zip")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	observer := make(chan *model.Event, 1)
+	key := address.Zip(zip)
+
+	subscriptions := metrics.ActiveSubscriptions.WithLabelValues(key)
+	subscriptions.Inc()
+
+	//Cleanup empty observer channels
+	go func() {
+		<-ctx.Done()
+		subscriptions.Dec()
+		r.MU.Lock()
+		delete(r.Observers[key], userID)
+		if len(r.Observers[key]) == 0 {
+			delete(r.Observers, key)
+		}
+		r.MU.Unlock()
+	}()
+
+	r.MU.Lock()
+	if r.Observers[key] == nil {
+		localObservers := make(map[string]chan *model.Event, 1)
+		r.Observers[key] = localObservers
+	}
+	r.Observers[key][userID] = observer
+	r.MU.Unlock()
+
+	return observer, nil
+}
+
+func (r *subscriptionResolver) EventNotifications(ctx context.Context, userID string) (<-chan *model.Notification, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+	//Users can only listen to their own notifications, userId is kept for older clients
+	key := userFromCtx.UUIDKey.ID.String()
+	if userID != key {
+		return nil, apperrors.Forbidden("notifications are private to user")
+	}
+
+	observer := make(chan *model.Notification, 1)
+	//Every subscription gets its own channel, so a user can be subscribed from several devices at once
+	subscriptionID := uuid.NewV4().String()
+
+	//Cleanup this subscription's channel
+	go func() {
+		<-ctx.Done()
+		r.MU.Lock()
+		delete(r.NotificationObservers[key], subscriptionID)
+		if len(r.NotificationObservers[key]) == 0 {
+			delete(r.NotificationObservers, key)
+		}
+		r.MU.Unlock()
+	}()
+
+	r.MU.Lock()
+	if r.NotificationObservers[key] == nil {
+		r.NotificationObservers[key] = make(map[string]chan *model.Notification, 1)
+	}
+	r.NotificationObservers[key][subscriptionID] = observer
+	r.MU.Unlock()
+
+	return observer, nil
+}
+
+func (r *userResolver) ID(ctx context.Context, obj *model.User) (string, error) {
+	return obj.UUIDKey.ID.String(), nil
+}
+
+func (r *userResolver) Email(ctx context.Context, obj *model.User) (string, error) {
+	return "", apperrors.Forbidden("access denied, email is private to user")
+}
+
+func (r *userResolver) Password(ctx context.Context, obj *model.User) (string, error) {
+	return "", apperrors.Forbidden("access denied, password is private to user")
+}
+
+func (r *userResolver) ProfilePicture(ctx context.Context, obj *model.User) (*model.File, error) {
+	userFromCtx := auth.ForContext(ctx)
+	if userFromCtx == nil {
+		return nil, apperrors.Unauthenticated()
+	}
+
+	fileBytes, err := ioutil.ReadFile(userFromCtx.ProfilePicturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.Split(userFromCtx.ProfilePicturePath, ".")[1]
+
+	return &model.File{
+		Name:        userFromCtx.Username + "." + ext,
+		Content:     string(fileBytes),
+		ContentType: "image/" + ext,
+	}, nil
+}
+
+func (r *userResolver) AttendingEvents(ctx context.Context, obj *model.User, includeCancelled *bool, first *int, after *string, last *int, before *string) (*model.EventConnection, error) {
+	args := pagination.Args{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
+	}
+	page, err := pagination.NewPage(args)
+	if err != nil {
+		return nil, err
+	}
+
+	attendingEvents, err := loaders.For(ctx, r.db(ctx)).AttendingEvents(obj.UUIDKey.ID, args, includeCancelled != nil && *includeCancelled)
+	if err != nil {
+		return nil, err
+	}
+
+	return eventConnection(attendingEvents, page.Trim(&attendingEvents)), nil
+}
+
+func (r *userResolver) OwnedEvents(ctx context.Context, obj *model.User, includeCancelled *bool, first *int, after *string, last *int, before *string) (*model.EventConnection, error) {
+	args := pagination.Args{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
+	}
+	page, err := pagination.NewPage(args)
+	if err != nil {
+		return nil, err
+	}
+
+	ownedEvents, err := loaders.For(ctx, r.db(ctx)).OwnedEvents(obj.UUIDKey.ID, args, includeCancelled != nil && *includeCancelled)
+	if err != nil {
+		return nil, err
+	}
+
+	return eventConnection(ownedEvents, page.Trim(&ownedEvents)), nil
+}
+
+func (r *venueResolver) ID(ctx context.Context, obj *model.Venue) (string, error) {
+	return obj.UUIDKey.ID.String(), nil
+}
+
+func (r *venueResolver) Owner(ctx context.Context, obj *model.Venue) (*model.User, error) {
+	return loaders.For(ctx, r.db(ctx)).User(obj.OwnerID)
+}
+
+// CalendarFeed returns generated.CalendarFeedResolver implementation.
+func (r *Resolver) CalendarFeed() generated.CalendarFeedResolver { return &calendarFeedResolver{r} }
+
+// Category returns generated.CategoryResolver implementation.
+func (r *Resolver) Category() generated.CategoryResolver { return &categoryResolver{r} }
+
 // Event returns generated.EventResolver implementation.
 func (r *Resolver) Event() generated.EventResolver { return &eventResolver{r} }
 
+// EventGroup returns generated.EventGroupResolver implementation.
+func (r *Resolver) EventGroup() generated.EventGroupResolver { return &eventGroupResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
+// Notification returns generated.NotificationResolver implementation.
+func (r *Resolver) Notification() generated.NotificationResolver { return &notificationResolver{r} }
+
+// PostalAddress returns generated.PostalAddressResolver implementation.
+func (r *Resolver) PostalAddress() generated.PostalAddressResolver { return &postalAddressResolver{r} }
+
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
@@ -557,8 +1506,17 @@ func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subsc
 // User returns generated.UserResolver implementation.
 func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
 
+// Venue returns generated.VenueResolver implementation.
+func (r *Resolver) Venue() generated.VenueResolver { return &venueResolver{r} }
+
+type calendarFeedResolver struct{ *Resolver }
+type categoryResolver struct{ *Resolver }
 type eventResolver struct{ *Resolver }
+type eventGroupResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type notificationResolver struct{ *Resolver }
+type postalAddressResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
+type venueResolver struct{ *Resolver }
@@ -0,0 +1,360 @@
+package address
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+)
+
+const (
+	MaxLines      = 3
+	MaxLineLength = 100
+	// maxPostalCodeLength bounds postal codes in countries without a known format
+	maxPostalCodeLength = 12
+)
+
+// layout is the order a country writes the last lines of an address in
+type layout int
+
+const (
+	// Locality, region and postal code on one line, like "Springfield, IL 62701"
+	localityFirst layout = iota
+	// Postal code before the locality, like "10115 Berlin"
+	postalCodeFirst
+	// Locality and postal code on lines of their own, like in the UK
+	separateLines
+	// Postal code, then region and locality, then the street, like in Japan
+	largestFirst
+)
+
+// Country holds a country's addressing rules
+type Country struct {
+	Name string
+	// PostalCode matches valid postal codes after normalizing. Countries without postal codes leave it nil.
+	PostalCode         *regexp.Regexp
+	PostalCodeRequired bool
+	// Regions lists the valid region codes. Empty means any region is accepted.
+	Regions        map[string]bool
+	RegionRequired bool
+	Layout         layout
+}
+
+func regions(codes ...string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// Countries are the countries whose rules are known. Addresses in other countries only need a locality and a line.
+var Countries = map[string]Country{
+	"US": {
+		Name:               "United States",
+		PostalCode:         regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+		PostalCodeRequired: true,
+		Regions: regions("AL", "AK", "AZ", "AR", "CA", "CO", "CT", "DE", "FL", "GA", "HI", "ID", "IL", "IN", "IA",
+			"KS", "KY", "LA", "ME", "MD", "MA", "MI", "MN", "MS", "MO", "MT", "NE", "NV", "NH", "NJ", "NM", "NY", "NC",
+			"ND", "OH", "OK", "OR", "PA", "RI", "SC", "SD", "TN", "TX", "UT", "VT", "VA", "WA", "WV", "WI", "WY", "DC",
+			"AS", "GU", "MP", "PR", "VI"),
+		RegionRequired: true,
+		Layout:         localityFirst,
+	},
+	"CA": {
+		Name:               "Canada",
+		PostalCode:         regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[A-Z] \d[A-Z]\d$`),
+		PostalCodeRequired: true,
+		Regions:            regions("AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"),
+		RegionRequired:     true,
+		Layout:             localityFirst,
+	},
+	"AU": {
+		Name:               "Australia",
+		PostalCode:         regexp.MustCompile(`^\d{4}$`),
+		PostalCodeRequired: true,
+		Regions:            regions("ACT", "NSW", "NT", "QLD", "SA", "TAS", "VIC", "WA"),
+		RegionRequired:     true,
+		Layout:             localityFirst,
+	},
+	"MX": {
+		Name:               "Mexico",
+		PostalCode:         regexp.MustCompile(`^\d{5}$`),
+		PostalCodeRequired: true,
+		RegionRequired:     true,
+		Layout:             postalCodeFirst,
+	},
+	"BR": {
+		Name:               "Brazil",
+		PostalCode:         regexp.MustCompile(`^\d{5}-\d{3}$`),
+		PostalCodeRequired: true,
+		RegionRequired:     true,
+		Layout:             localityFirst,
+	},
+	"GB": {
+		Name:               "United Kingdom",
+		PostalCode:         regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`),
+		PostalCodeRequired: true,
+		Layout:             separateLines,
+	},
+	"IE": {
+		Name: "Ireland",
+		//Eircodes are optional, many addresses are still written without one
+		PostalCode: regexp.MustCompile(`^[A-Z]\d[\dW] [A-Z\d]{4}$`),
+		Layout:     separateLines,
+	},
+	"DE": {Name: "Germany", PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true, Layout: postalCodeFirst},
+	"FR": {Name: "France", PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true, Layout: postalCodeFirst},
+	"ES": {Name: "Spain", PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true, Layout: postalCodeFirst},
+	"IT": {Name: "Italy", PostalCode: regexp.MustCompile(`^\d{5}$`), PostalCodeRequired: true, Layout: postalCodeFirst},
+	"NL": {Name: "Netherlands", PostalCode: regexp.MustCompile(`^\d{4} [A-Z]{2}$`), PostalCodeRequired: true, Layout: postalCodeFirst},
+	"IN": {
+		Name:               "India",
+		PostalCode:         regexp.MustCompile(`^\d{6}$`),
+		PostalCodeRequired: true,
+		RegionRequired:     true,
+		Layout:             localityFirst,
+	},
+	"JP": {
+		Name:               "Japan",
+		PostalCode:         regexp.MustCompile(`^\d{3}-\d{4}$`),
+		PostalCodeRequired: true,
+		RegionRequired:     true,
+		Layout:             largestFirst,
+	},
+}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// compact postal codes get the separator their country writes them with
+var separators = map[string]struct {
+	compact *regexp.Regexp
+	with    string
+}{
+	"CA": {regexp.MustCompile(`^([A-Z]\d[A-Z])(\d[A-Z]\d)$`), "$1 $2"},
+	"GB": {regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]?)(\d[A-Z]{2})$`), "$1 $2"},
+	"IE": {regexp.MustCompile(`^([A-Z]\d[\dW])([A-Z\d]{4})$`), "$1 $2"},
+	"NL": {regexp.MustCompile(`^(\d{4})([A-Z]{2})$`), "$1 $2"},
+	"BR": {regexp.MustCompile(`^(\d{5})(\d{3})$`), "$1-$2"},
+	"JP": {regexp.MustCompile(`^(\d{3})(\d{4})$`), "$1-$2"},
+	"US": {regexp.MustCompile(`^(\d{5})(\d{4})$`), "$1-$2"},
+}
+
+func clean(s string) string {
+	return spaces.ReplaceAllString(strings.TrimSpace(s), " ")
+}
+
+// Normalize trims every field, drops empty lines and writes codes the way their country does, so equal addresses
+// compare equal
+func Normalize(address model.PostalAddress) model.PostalAddress {
+	normalized := model.PostalAddress{
+		CountryCode: strings.ToUpper(clean(address.CountryCode)),
+		PostalCode:  strings.ToUpper(clean(address.PostalCode)),
+		Region:      clean(address.Region),
+		Locality:    clean(address.Locality),
+		Lines:       []string{},
+	}
+	for _, line := range address.Lines {
+		if line = clean(line); line != "" {
+			normalized.Lines = append(normalized.Lines, line)
+		}
+	}
+
+	rules, ok := Countries[normalized.CountryCode]
+	if ok && rules.Regions != nil {
+		normalized.Region = strings.ToUpper(normalized.Region)
+	}
+	if separator, ok := separators[normalized.CountryCode]; ok {
+		compact := strings.NewReplacer(" ", "", "-", "").Replace(normalized.PostalCode)
+		if separator.compact.MatchString(compact) {
+			normalized.PostalCode = separator.compact.ReplaceAllString(compact, separator.with)
+		}
+	}
+
+	return normalized
+}
+
+// FromInput builds a normalized address from its GraphQL input
+func FromInput(input model.PostalAddressInput) model.PostalAddress {
+	address := model.PostalAddress{
+		CountryCode: input.CountryCode,
+		Locality:    input.Locality,
+		Lines:       input.Lines,
+	}
+	if input.PostalCode != nil {
+		address.PostalCode = *input.PostalCode
+	}
+	if input.Region != nil {
+		address.Region = *input.Region
+	}
+	return Normalize(address)
+}
+
+// FromLegacy builds a US address from the deprecated address fields
+func FromLegacy(line1 *string, line2 *string, city *string, state *string, zip *int) model.PostalAddress {
+	address := model.PostalAddress{CountryCode: "US"}
+	for _, line := range []*string{line1, line2} {
+		if line != nil {
+			address.Lines = append(address.Lines, *line)
+		}
+	}
+	if city != nil {
+		address.Locality = *city
+	}
+	if state != nil {
+		address.Region = *state
+	}
+	if zip != nil {
+		address.PostalCode = Zip(*zip)
+	}
+	return Normalize(address)
+}
+
+// Zip writes a US zip code stored as an int with its leading zeros
+func Zip(zip int) string {
+	return fmt.Sprintf("%05d", zip)
+}
+
+// LegacyZip is the five digit zip code of a US address as an int, or 0 for addresses without one
+func LegacyZip(address model.PostalAddress) int {
+	if address.CountryCode != "US" || len(address.PostalCode) < 5 {
+		return 0
+	}
+	zip, err := strconv.Atoi(address.PostalCode[:5])
+	if err != nil {
+		return 0
+	}
+	return zip
+}
+
+// Line returns one of an address's lines, or an empty string if it doesn't have that many
+func Line(address model.PostalAddress, i int) string {
+	if i < len(address.Lines) {
+		return address.Lines[i]
+	}
+	return ""
+}
+
+// Check validates a normalized address against its country's rules. Paths are relative to the address.
+func Check(address model.PostalAddress) []apperrors.FieldError {
+	problems := []apperrors.FieldError{}
+
+	if !countryCode.MatchString(address.CountryCode) {
+		problems = append(problems, apperrors.Field("must be a two letter ISO 3166 country code like US", "countryCode"))
+	}
+	rules, known := Countries[address.CountryCode]
+
+	switch {
+	case len(address.Lines) == 0:
+		problems = append(problems, apperrors.Field("can't be empty", "lines"))
+	case len(address.Lines) > MaxLines:
+		problems = append(problems, apperrors.Field("can have at most "+strconv.Itoa(MaxLines)+" lines", "lines"))
+	}
+	for i, line := range address.Lines {
+		if len([]rune(line)) > MaxLineLength {
+			problems = append(problems, apperrors.Field("must be at most "+strconv.Itoa(MaxLineLength)+" characters", "lines", strconv.Itoa(i)))
+		}
+	}
+
+	switch {
+	case address.Locality == "":
+		problems = append(problems, apperrors.Field("can't be empty", "locality"))
+	case len([]rune(address.Locality)) > MaxLineLength:
+		problems = append(problems, apperrors.Field("must be at most "+strconv.Itoa(MaxLineLength)+" characters", "locality"))
+	}
+
+	switch {
+	case address.Region == "" && rules.RegionRequired:
+		problems = append(problems, apperrors.Field("is required in "+rules.Name, "region"))
+	case address.Region != "" && len(rules.Regions) > 0 && !rules.Regions[address.Region]:
+		problems = append(problems, apperrors.Field("isn't a region code of "+rules.Name, "region"))
+	case len([]rune(address.Region)) > MaxLineLength:
+		problems = append(problems, apperrors.Field("must be at most "+strconv.Itoa(MaxLineLength)+" characters", "region"))
+	}
+
+	switch {
+	case address.PostalCode == "" && rules.PostalCodeRequired:
+		problems = append(problems, apperrors.Field("is required in "+rules.Name, "postalCode"))
+	case address.PostalCode == "":
+	case known && rules.PostalCode != nil && !rules.PostalCode.MatchString(address.PostalCode):
+		problems = append(problems, apperrors.Field("isn't a valid postal code in "+rules.Name, "postalCode"))
+	case len(address.PostalCode) > maxPostalCodeLength:
+		problems = append(problems, apperrors.Field("must be at most "+strconv.Itoa(maxPostalCodeLength)+" characters", "postalCode"))
+	}
+
+	return problems
+}
+
+// FormatLines writes an address the way its country does, one line per entry. The country name comes last.
+func FormatLines(address model.PostalAddress) []string {
+	rules, known := Countries[address.CountryCode]
+	country := address.CountryCode
+	if known {
+		country = rules.Name
+	}
+
+	join := func(parts ...string) string {
+		nonEmpty := []string{}
+		for _, part := range parts {
+			if part != "" {
+				nonEmpty = append(nonEmpty, part)
+			}
+		}
+		return strings.Join(nonEmpty, " ")
+	}
+
+	lines := []string{}
+	switch rules.Layout {
+	case localityFirst:
+		locality := address.Locality
+		if address.Region != "" || address.PostalCode != "" {
+			locality += ","
+		}
+		lines = append(lines, address.Lines...)
+		lines = append(lines, join(locality, address.Region, address.PostalCode))
+	case postalCodeFirst:
+		lines = append(lines, address.Lines...)
+		lines = append(lines, join(address.PostalCode, address.Locality))
+		if address.Region != "" {
+			lines = append(lines, address.Region)
+		}
+	case separateLines:
+		lines = append(lines, address.Lines...)
+		lines = append(lines, join(address.Locality))
+		if address.Region != "" {
+			lines = append(lines, address.Region)
+		}
+		if address.PostalCode != "" {
+			lines = append(lines, address.PostalCode)
+		}
+	case largestFirst:
+		if address.PostalCode != "" {
+			lines = append(lines, "〒"+address.PostalCode)
+		}
+		lines = append(lines, join(address.Region, address.Locality))
+		lines = append(lines, address.Lines...)
+	}
+
+	return append(lines, country)
+}
+
+// Format writes an address on multiple lines, the way it would go on an envelope
+func Format(address model.PostalAddress) string {
+	return strings.Join(FormatLines(address), "\n")
+}
+
+// Query writes an address on one line for geocoding, from the most to the least specific part
+func Query(address model.PostalAddress) string {
+	parts := append([]string{}, address.Lines...)
+	for _, part := range []string{address.Locality, address.Region, address.PostalCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,103 @@
+package apperrors
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Codes clients can branch on. They're sent in the code extension of every error the API returns.
+const (
+	CodeUnauthenticated  = "UNAUTHENTICATED"
+	CodeNotFound         = "NOT_FOUND"
+	CodeForbidden        = "FORBIDDEN"
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeConflict         = "CONFLICT"
+	CodeRateLimited      = "RATE_LIMITED"
+	CodeInternal         = "INTERNAL_SERVER_ERROR"
+)
+
+// Error is an error whose message is safe to show to clients
+type Error struct {
+	Code    string
+	Message string
+	// Fields lists the inputs that failed validation
+	Fields []FieldError
+	// Extensions are added to the error's extensions next to its code
+	Extensions map[string]interface{}
+	// Err is the error that caused this one. It's logged, never shown.
+	Err error
+}
+
+// FieldError points at one invalid input, like ["input", "startTime"]
+type FieldError struct {
+	Path    []string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap records the error that caused this one
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// Unauthenticated is returned when an operation needs a user and the request didn't carry a valid token
+func Unauthenticated() *Error {
+	return &Error{Code: CodeUnauthenticated, Message: "no user information from context. You probably didn't provide a token"}
+}
+
+// NotFound is returned when the thing being looked up doesn't exist or the user may not see it
+func NotFound(thing string) *Error {
+	return &Error{Code: CodeNotFound, Message: thing + " not found"}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+// Validation is returned when an input is invalid. Its message lists every field error.
+func Validation(fields ...FieldError) *Error {
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = strings.Join(field.Path, ".") + ": " + field.Message
+	}
+
+	message := "invalid input"
+	if len(messages) > 0 {
+		message += ", " + strings.Join(messages, "; ")
+	}
+
+	return &Error{Code: CodeValidationFailed, Message: message, Fields: fields}
+}
+
+// Invalid is returned when a request is invalid as a whole, rather than one of its fields
+func Invalid(message string) *Error {
+	return &Error{Code: CodeValidationFailed, Message: message}
+}
+
+// Field builds a field error for the input at path
+func Field(message string, path ...string) FieldError {
+	return FieldError{Path: path, Message: message}
+}
+
+// Conflict is returned when a change clashes with the current state, like a duplicate name or a move an event's
+// status doesn't allow
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+// RateLimited is returned when a client has to wait retryAfter seconds before trying again
+func RateLimited(retryAfter int) *Error {
+	return &Error{
+		Code:       CodeRateLimited,
+		Message:    "too many requests, retry after " + strconv.Itoa(retryAfter) + " seconds",
+		Extensions: map[string]interface{}{"retryAfter": retryAfter},
+	}
+}
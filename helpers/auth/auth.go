@@ -7,6 +7,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/opaquee/EventMapAPI/graph/model"
 	"github.com/opaquee/EventMapAPI/helpers/jwt"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
 	"github.com/opaquee/EventMapAPI/helpers/users"
 )
 
@@ -33,7 +34,7 @@ func Middleware(db *gorm.DB) func(http.Handler) http.Handler {
 				return
 			}
 
-			userFromDB, err := users.GetUserByUsername(username, db)
+			userFromDB, err := users.GetUserByUsername(username, tracing.WithContext(r.Context(), db))
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -45,6 +46,7 @@ func Middleware(db *gorm.DB) func(http.Handler) http.Handler {
 				FirstName:          userFromDB.FirstName,
 				LastName:           userFromDB.LastName,
 				ProfilePicturePath: userFromDB.ProfilePicturePath,
+				IsStaff:            userFromDB.IsStaff,
 			}
 
 			ctx := context.WithValue(r.Context(), userCtxKey, &user)
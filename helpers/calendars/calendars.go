@@ -0,0 +1,97 @@
+package calendars
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MaxFeeds is how many calendar feeds a user can have at once, one for each of their calendar apps
+const MaxFeeds = 10
+
+// Hash is what's stored of a feed's token. Tokens are random enough that a plain hash can't be brute forced.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Path is where a feed with the given token is served
+func Path(token string) string {
+	return "/calendar/" + token + ".ics"
+}
+
+// Create makes a new feed for a user. Its token is only returned in the feed's URL, since just its hash is kept.
+func Create(db *gorm.DB, user *model.User, name string) (*model.CalendarFeed, error) {
+	count := 0
+	if err := db.Model(&model.CalendarFeed{}).Where("user_id = ?", user.UUIDKey.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= MaxFeeds {
+		return nil, apperrors.Conflict("users can have at most " + strconv.Itoa(MaxFeeds) + " calendar feeds, revoke one first")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	feed := &model.CalendarFeed{
+		UserID:    user.UUIDKey.ID,
+		Name:      name,
+		TokenHash: Hash(token),
+	}
+	if err := db.Create(feed).Error; err != nil {
+		return nil, err
+	}
+
+	url := Path(token)
+	feed.URL = &url
+	return feed, nil
+}
+
+// GetFeedByID finds one of a user's feeds. Other users' feeds aren't found.
+func GetFeedByID(feedID string, user *model.User, db *gorm.DB) (*model.CalendarFeed, error) {
+	id, err := uuid.FromString(feedID)
+	if err != nil {
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "feedId"))
+	}
+
+	feed := &model.CalendarFeed{}
+	if err := db.Where("id = ? AND user_id = ?", id, user.UUIDKey.ID).First(feed).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, apperrors.NotFound("calendar feed")
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// ForToken finds the feed a token belongs to along with its user, and records that it was used. Revoked feeds
+// and feeds of deleted users aren't found.
+func ForToken(db *gorm.DB, token string) (*model.CalendarFeed, *model.User, error) {
+	feed := &model.CalendarFeed{}
+	if err := db.Where("token_hash = ?", Hash(token)).First(feed).Error; err != nil {
+		return nil, nil, err
+	}
+
+	user := &model.User{}
+	if err := db.Where("id = ?", feed.UserID).First(user).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if err := db.Model(feed).UpdateColumn("last_used_at", time.Now()).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return feed, user, nil
+}
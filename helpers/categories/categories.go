@@ -0,0 +1,65 @@
+package categories
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Slug turns a category name into the stable identifier used in filters, e.g. "Live Music" becomes "live-music"
+func Slug(name string) string {
+	var builder strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+			dash = false
+		} else if !dash && builder.Len() > 0 {
+			builder.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(builder.String(), "-")
+}
+
+func Duplicate(category *model.Category, db *gorm.DB) error {
+	var existing model.Category
+
+	err := db.Where(&model.Category{
+		Slug: category.Slug,
+	}).Not("id", category.UUIDKey.ID).First(&existing).Error
+
+	if err != nil && gorm.IsRecordNotFoundError(err) == false {
+		return err
+	}
+
+	if gorm.IsRecordNotFoundError(err) == false {
+		return apperrors.Conflict("category already exists")
+	}
+
+	return nil
+}
+
+func GetCategoryByID(categoryID string, db *gorm.DB) (*model.Category, error) {
+	id, err := uuid.FromString(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	category := &model.Category{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	}
+
+	if err := db.Where(category).First(category).Error; err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
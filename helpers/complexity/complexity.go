@@ -0,0 +1,155 @@
+package complexity
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/opaquee/EventMapAPI/graph/generated"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errDepthLimit = "DEPTH_LIMIT_EXCEEDED"
+
+// pageSize is how many items a paginated field can return for its arguments. Out of range arguments are clamped to
+// what pagination allows, so negative or huge values can't shrink or overflow the cost.
+func pageSize(first *int, last *int) int {
+	size := pagination.DefaultPageSize
+	if first != nil {
+		size = *first
+	} else if last != nil {
+		size = *last
+	}
+
+	if size < 1 {
+		return 1
+	}
+	if size > pagination.MaxPageSize() {
+		return pagination.MaxPageSize()
+	}
+	return size
+}
+
+// Configure weights list fields by how many items they can return, so nesting lists multiplies their cost.
+// Fields without a weight cost one plus their children.
+func Configure(root *generated.ComplexityRoot) {
+	root.Event.Users = func(childComplexity int, first *int, after *string, last *int, before *string) int {
+		return 1 + pageSize(first, last)*childComplexity
+	}
+	root.User.AttendingEvents = func(childComplexity int, includeCancelled *bool, first *int, after *string, last *int, before *string) int {
+		return 1 + pageSize(first, last)*childComplexity
+	}
+	root.User.OwnedEvents = func(childComplexity int, includeCancelled *bool, first *int, after *string, last *int, before *string) int {
+		return 1 + pageSize(first, last)*childComplexity
+	}
+	root.Query.GetAllNearbyEvents = func(childComplexity int, zip int, includeCancelled *bool, includeOnline *bool, filter *model.EventFilter, first *int, after *string, last *int, before *string) int {
+		return 1 + pageSize(first, last)*childComplexity
+	}
+	root.Query.SearchEvents = func(childComplexity int, query string, near *model.LocationInput, radiusKm *float64, includeCancelled *bool, includeOnline *bool, from *time.Time, to *time.Time, categories []string, first *int, after *string) int {
+		return 1 + pageSize(first, nil)*childComplexity
+	}
+	root.Query.AddressSuggestions = func(childComplexity int, prefix string, near *model.LocationInput, first *int) int {
+		return 1 + pageSize(first, nil)*childComplexity
+	}
+	root.Query.Venues = func(childComplexity int, near model.LocationInput, radiusKm *float64, first *int) int {
+		return 1 + pageSize(first, nil)*childComplexity
+	}
+
+	//Unpaginated lists are charged for as many items as they're capped at
+	root.Query.GetEventsInViewport = func(childComplexity int, bounds model.BoundsInput, includeCancelled *bool, includeOnline *bool, filter *model.EventFilter) int {
+		return 1 + events.MaxInViewport*childComplexity
+	}
+	root.Query.GetEventGroupsInViewport = func(childComplexity int, bounds model.BoundsInput, includeCancelled *bool, filter *model.EventFilter) int {
+		return 1 + events.MaxInViewport*childComplexity
+	}
+	root.Query.GetNotifications = func(childComplexity int, unreadOnly *bool) int {
+		return 1 + events.MaxNotifications*childComplexity
+	}
+}
+
+// Budget limits operation complexity per principal. Anonymous clients usually get the smallest budget and staff the largest.
+func Budget(cfg config.Complexity) *extension.ComplexityLimit {
+	return &extension.ComplexityLimit{
+		Func: func(ctx context.Context, rc *graphql.OperationContext) int {
+			user := auth.ForContext(ctx)
+			if user == nil {
+				return cfg.AnonymousBudget
+			}
+			if user.IsStaff {
+				return cfg.StaffBudget
+			}
+			return cfg.UserBudget
+		},
+	}
+}
+
+// DepthLimit rejects operations that nest fields deeper than the limit before they run. Introspection fields don't
+// count, so the playground keeps working.
+type DepthLimit struct {
+	Limit int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = DepthLimit{}
+
+func (d DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d DepthLimit) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (d DepthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	if depth := selectionDepth(op.SelectionSet); depth > d.Limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.Limit)
+		errcode.Set(err, errDepthLimit)
+		return err
+	}
+
+	return nil
+}
+
+func selectionDepth(selectionSet ast.SelectionSet) int {
+	deepest := 0
+
+	for _, selection := range selectionSet {
+		depth := 0
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name, "__") {
+				continue
+			}
+			depth = 1 + selectionDepth(selection.SelectionSet)
+		case *ast.InlineFragment:
+			depth = selectionDepth(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				depth = selectionDepth(selection.Definition.SelectionSet)
+			}
+		}
+
+		if depth > deepest {
+			deepest = depth
+		}
+	}
+
+	return deepest
+}
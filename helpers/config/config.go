@@ -0,0 +1,353 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting the server reads at startup. Values come from the defaults below, then an optional
+// YAML file, then environment variables, then command line flags, each overriding the one before.
+type Config struct {
+	Port        string        `yaml:"port" env:"PORT" flag:"port"`
+	Environment string        `yaml:"environment" env:"ENVIRONMENT" flag:"environment"`
+	LogLevel    string        `yaml:"logLevel" env:"LOG_LEVEL" flag:"log-level"`
+	Database    Database      `yaml:"database"`
+	JWT         JWT           `yaml:"jwt"`
+	Geocoder    Geocoder      `yaml:"geocoder"`
+	Spatial     Spatial       `yaml:"spatial"`
+	Uploads     Uploads       `yaml:"uploads"`
+	Purge       Purge         `yaml:"purge"`
+	Pagination  Pagination    `yaml:"pagination"`
+	Complexity  Complexity    `yaml:"complexity"`
+	APQ         APQ           `yaml:"apq"`
+	RateLimit   RateLimit     `yaml:"rateLimit"`
+	Tracing     Tracing       `yaml:"tracing"`
+	JobInterval time.Duration `yaml:"jobInterval" env:"JOB_INTERVAL" flag:"job-interval"`
+	// ShutdownTimeout is how long in-flight requests get to finish after a SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+}
+
+type Database struct {
+	Host            string        `yaml:"host" env:"DB_HOST" flag:"db-host"`
+	Port            int           `yaml:"port" env:"DB_PORT" flag:"db-port"`
+	Name            string        `yaml:"name" env:"DB_NAME" flag:"db-name"`
+	User            string        `yaml:"user" env:"DB_USER" flag:"db-user"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" flag:"db-password"`
+	SSLMode         string        `yaml:"sslMode" env:"DB_SSLMODE" flag:"db-sslmode"`
+	ConnectAttempts int           `yaml:"connectAttempts" env:"DB_CONNECT_ATTEMPTS" flag:"db-connect-attempts"`
+	RetryDelay      time.Duration `yaml:"retryDelay" env:"DB_RETRY_DELAY" flag:"db-retry-delay"`
+	MaxRetryDelay   time.Duration `yaml:"maxRetryDelay" env:"DB_MAX_RETRY_DELAY" flag:"db-max-retry-delay"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS" flag:"db-max-open-conns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS" flag:"db-max-idle-conns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME" flag:"db-conn-max-lifetime"`
+}
+
+type JWT struct {
+	Secret   string        `yaml:"secret" env:"JWT_SECRET" flag:"jwt-secret"`
+	TokenTTL time.Duration `yaml:"tokenTTL" env:"JWT_TOKEN_TTL" flag:"jwt-token-ttl"`
+}
+
+type Geocoder struct {
+	URL     string        `yaml:"url" env:"GEO_API_URL" flag:"geo-api-url"`
+	APIKey  string        `yaml:"apiKey" env:"GEO_API_KEY" flag:"geo-api-key"`
+	Timeout time.Duration `yaml:"timeout" env:"GEO_API_TIMEOUT" flag:"geo-api-timeout"`
+	// CheckReachable makes readiness depend on reaching the geocoder, not just on it being configured
+	CheckReachable bool `yaml:"checkReachable" env:"GEO_API_READINESS_CHECK" flag:"geo-api-readiness-check"`
+	// CacheSize is how many lookups are remembered, so repeated ones don't spend the geocoder's quota
+	CacheSize int           `yaml:"cacheSize" env:"GEO_CACHE_SIZE" flag:"geo-cache-size"`
+	CacheTTL  time.Duration `yaml:"cacheTTL" env:"GEO_CACHE_TTL" flag:"geo-cache-ttl"`
+}
+
+type Spatial struct {
+	// Index is how location queries find events: postgis, geohash, or auto to use PostGIS when migrations could add it
+	Index string `yaml:"index" env:"SPATIAL_INDEX" flag:"spatial-index"`
+}
+
+type Uploads struct {
+	Dir string `yaml:"dir" env:"APP_VOLUME" flag:"uploads-dir"`
+}
+
+type Purge struct {
+	AfterDays int           `yaml:"afterDays" env:"PURGE_AFTER_DAYS" flag:"purge-after-days"`
+	Interval  time.Duration `yaml:"interval" env:"PURGE_INTERVAL" flag:"purge-interval"`
+}
+
+type Pagination struct {
+	MaxPageSize int `yaml:"maxPageSize" env:"PAGINATION_MAX_PAGE_SIZE" flag:"max-page-size"`
+}
+
+type Complexity struct {
+	MaxDepth        int `yaml:"maxDepth" env:"MAX_QUERY_DEPTH" flag:"max-query-depth"`
+	AnonymousBudget int `yaml:"anonymousBudget" env:"COMPLEXITY_BUDGET_ANONYMOUS" flag:"complexity-budget-anonymous"`
+	UserBudget      int `yaml:"userBudget" env:"COMPLEXITY_BUDGET_USER" flag:"complexity-budget-user"`
+	StaffBudget     int `yaml:"staffBudget" env:"COMPLEXITY_BUDGET_STAFF" flag:"complexity-budget-staff"`
+}
+
+type APQ struct {
+	Cache         string `yaml:"cache" env:"APQ_CACHE" flag:"apq-cache"`
+	CacheSize     int    `yaml:"cacheSize" env:"APQ_CACHE_SIZE" flag:"apq-cache-size"`
+	PersistedOnly bool   `yaml:"persistedOnly" env:"PERSISTED_QUERIES_ONLY" flag:"persisted-queries-only"`
+}
+
+type RateLimit struct {
+	Backend           string `yaml:"backend" env:"RATE_LIMIT_BACKEND" flag:"rate-limit-backend"`
+	TrustProxyHeaders bool   `yaml:"trustProxyHeaders" env:"TRUST_PROXY_HEADERS" flag:"trust-proxy-headers"`
+}
+
+type Tracing struct {
+	// Exporter is none, otlp to send spans to a collector over HTTP, or stdout to print them while debugging
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	OTLPEndpoint string  `yaml:"otlpEndpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint"`
+	ServiceName  string  `yaml:"serviceName" env:"OTEL_SERVICE_NAME" flag:"service-name"`
+	SampleRatio  float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio"`
+}
+
+func Default() *Config {
+	return &Config{
+		Port:        "8080",
+		Environment: "development",
+		LogLevel:    "info",
+		Database: Database{
+			Host:            "localhost",
+			Port:            5432,
+			Name:            "postgres",
+			User:            "postgres",
+			SSLMode:         "disable",
+			ConnectAttempts: 8,
+			RetryDelay:      500 * time.Millisecond,
+			MaxRetryDelay:   10 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		JWT: JWT{
+			TokenTTL: time.Hour,
+		},
+		Geocoder: Geocoder{
+			URL:       "http://api.positionstack.com",
+			Timeout:   10 * time.Second,
+			CacheSize: 10000,
+			CacheTTL:  24 * time.Hour,
+		},
+		Spatial: Spatial{
+			Index: "auto",
+		},
+		Purge: Purge{
+			AfterDays: 30,
+			Interval:  time.Hour,
+		},
+		Pagination: Pagination{
+			MaxPageSize: 100,
+		},
+		//A viewport of up to 5000 events with a handful of fields each has to fit every budget
+		Complexity: Complexity{
+			MaxDepth:        12,
+			AnonymousBudget: 40000,
+			UserBudget:      100000,
+			StaffBudget:     400000,
+		},
+		APQ: APQ{
+			Cache:     "memory",
+			CacheSize: 1000,
+		},
+		RateLimit: RateLimit{
+			Backend: "memory",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "eventmap-api",
+			SampleRatio: 1,
+		},
+		JobInterval:     time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// setting is one leaf field of the config along with where it can be set from
+type setting struct {
+	value reflect.Value
+	yaml  string
+	env   string
+	flag  string
+}
+
+func (s setting) String() string {
+	return s.env + " (" + s.yaml + ", -" + s.flag + ")"
+}
+
+func settings(value reflect.Value, prefix string) []setting {
+	all := []setting{}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct {
+			all = append(all, settings(value.Field(i), name+".")...)
+			continue
+		}
+
+		all = append(all, setting{
+			value: value.Field(i),
+			yaml:  name,
+			env:   field.Tag.Get("env"),
+			flag:  field.Tag.Get("flag"),
+		})
+	}
+
+	return all
+}
+
+func (s setting) set(raw string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(raw)
+	case int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		s.value.SetInt(int64(parsed))
+	case float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		s.value.SetFloat(parsed)
+	case bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		s.value.SetBool(parsed)
+	case time.Duration:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("must be a duration such as 30s or 5m")
+		}
+		s.value.SetInt(int64(parsed))
+	}
+	return nil
+}
+
+// Load reads the configuration for the given command line arguments. The YAML file is named with -config or
+// CONFIG_FILE. Every problem found is reported together, so a bad deployment can be fixed in one go.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	all := settings(reflect.ValueOf(cfg).Elem(), "")
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML file to read settings from")
+	flagValues := map[string]*string{}
+	for _, s := range all {
+		flagValues[s.flag] = flags.String(s.flag, "", "overrides "+s.env)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		content, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: %v", *configFile, err)
+		}
+	}
+
+	problems := []string{}
+	for _, s := range all {
+		if raw, ok := os.LookupEnv(s.env); ok && raw != "" {
+			if err := s.set(raw); err != nil {
+				problems = append(problems, s.String()+": "+err.Error())
+			}
+		}
+	}
+	bySetFlag := map[string]setting{}
+	for _, s := range all {
+		bySetFlag[s.flag] = s
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if s, ok := bySetFlag[f.Name]; ok {
+			if err := s.set(*flagValues[f.Name]); err != nil {
+				problems = append(problems, s.String()+": "+err.Error())
+			}
+		}
+	})
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) validate() []string {
+	problems := []string{}
+	check := func(ok bool, setting string, problem string) {
+		if !ok {
+			problems = append(problems, setting+": "+problem)
+		}
+	}
+
+	port, err := strconv.Atoi(cfg.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT", "must be a port number")
+	check(cfg.Environment == "development" || cfg.Environment == "production", "ENVIRONMENT", "must be development or production")
+	check(cfg.LogLevel == "debug" || cfg.LogLevel == "info" || cfg.LogLevel == "warn" || cfg.LogLevel == "error", "LOG_LEVEL", "must be debug, info, warn or error")
+
+	check(cfg.Database.Host != "", "DB_HOST", "must be set")
+	check(cfg.Database.Port > 0 && cfg.Database.Port < 65536, "DB_PORT", "must be a port number")
+	check(cfg.Database.Name != "", "DB_NAME", "must be set")
+	check(cfg.Database.User != "", "DB_USER", "must be set")
+	check(cfg.Database.ConnectAttempts > 0, "DB_CONNECT_ATTEMPTS", "must be at least 1")
+	check(cfg.Database.RetryDelay > 0, "DB_RETRY_DELAY", "must be positive")
+	check(cfg.Database.MaxRetryDelay >= cfg.Database.RetryDelay, "DB_MAX_RETRY_DELAY", "can't be less than DB_RETRY_DELAY")
+	check(cfg.Database.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS", "must be at least 1")
+	check(cfg.Database.MaxIdleConns >= 0 && cfg.Database.MaxIdleConns <= cfg.Database.MaxOpenConns, "DB_MAX_IDLE_CONNS", "must be between 0 and DB_MAX_OPEN_CONNS")
+	check(cfg.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME", "can't be negative")
+
+	check(cfg.JWT.Secret != "", "JWT_SECRET", "must be set")
+	check(cfg.Environment != "production" || len(cfg.JWT.Secret) >= 32, "JWT_SECRET", "must be at least 32 characters in production")
+	check(cfg.JWT.TokenTTL > 0, "JWT_TOKEN_TTL", "must be positive")
+
+	check(strings.HasPrefix(cfg.Geocoder.URL, "http://") || strings.HasPrefix(cfg.Geocoder.URL, "https://"), "GEO_API_URL", "must be an http or https URL")
+	check(cfg.Geocoder.Timeout > 0, "GEO_API_TIMEOUT", "must be positive")
+	check(cfg.Geocoder.CacheSize > 0, "GEO_CACHE_SIZE", "must be at least 1")
+	check(cfg.Geocoder.CacheTTL > 0, "GEO_CACHE_TTL", "must be positive")
+
+	check(cfg.Spatial.Index == "auto" || cfg.Spatial.Index == "postgis" || cfg.Spatial.Index == "geohash", "SPATIAL_INDEX", "must be auto, postgis or geohash")
+
+	check(cfg.Purge.AfterDays > 0, "PURGE_AFTER_DAYS", "must be at least 1")
+	check(cfg.Purge.Interval > 0, "PURGE_INTERVAL", "must be positive")
+	check(cfg.Pagination.MaxPageSize > 0, "PAGINATION_MAX_PAGE_SIZE", "must be at least 1")
+
+	check(cfg.Complexity.MaxDepth > 0, "MAX_QUERY_DEPTH", "must be at least 1")
+	check(cfg.Complexity.AnonymousBudget > 0, "COMPLEXITY_BUDGET_ANONYMOUS", "must be at least 1")
+	check(cfg.Complexity.UserBudget > 0, "COMPLEXITY_BUDGET_USER", "must be at least 1")
+	check(cfg.Complexity.StaffBudget > 0, "COMPLEXITY_BUDGET_STAFF", "must be at least 1")
+
+	check(cfg.APQ.Cache == "memory" || cfg.APQ.Cache == "postgres", "APQ_CACHE", "must be memory or postgres")
+	check(cfg.APQ.CacheSize > 0, "APQ_CACHE_SIZE", "must be at least 1")
+	check(cfg.RateLimit.Backend == "memory" || cfg.RateLimit.Backend == "postgres", "RATE_LIMIT_BACKEND", "must be memory or postgres")
+
+	check(cfg.Tracing.Exporter == "none" || cfg.Tracing.Exporter == "otlp" || cfg.Tracing.Exporter == "stdout", "TRACING_EXPORTER", "must be none, otlp or stdout")
+	check(cfg.Tracing.Exporter != "otlp" || strings.HasPrefix(cfg.Tracing.OTLPEndpoint, "http://") || strings.HasPrefix(cfg.Tracing.OTLPEndpoint, "https://"), "OTEL_EXPORTER_OTLP_ENDPOINT", "must be an http or https URL when exporting with otlp")
+	check(cfg.Tracing.ServiceName != "", "OTEL_SERVICE_NAME", "must be set")
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+
+	check(cfg.JobInterval > 0, "JOB_INTERVAL", "must be positive")
+	check(cfg.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT", "must be positive")
+
+	return problems
+}
@@ -1,8 +1,65 @@
 package dbconn
 
-import "github.com/jinzhu/gorm"
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
-func Open() (db *gorm.DB, err error) {
-	db, err = gorm.Open("postgres", "host=db port=5432 dbname=postgres user=user password=secret sslmode=disable")
-	return db, err
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+)
+
+// dsn is the connection URL for the configured database. Building it as a URL escapes every part, so empty values
+// and passwords with spaces or quotes can't run into the next setting.
+func dsn(cfg config.Database) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+func Open(cfg config.Database) (db *gorm.DB, err error) {
+	db, err = gorm.Open("postgres", dsn(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
+	db.DB().SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	return db, nil
+}
+
+// Connect opens the database, retrying with exponential backoff while it isn't accepting connections yet. It gives
+// up after the configured number of attempts, so a misconfigured server fails instead of waiting forever.
+func Connect(cfg config.Database) (*gorm.DB, error) {
+	delay := cfg.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		db, err := Open(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return nil, fmt.Errorf("couldn't connect to the database after %d attempts: %v", attempt, err)
+		}
+
+		logging.For(context.Background()).Warn("connecting to database failed, retrying",
+			"attempt", attempt, "attempts", cfg.ConnectAttempts, "retry_in", delay, "error", err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > cfg.MaxRetryDelay {
+			delay = cfg.MaxRetryDelay
+		}
+	}
 }
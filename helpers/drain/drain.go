@@ -0,0 +1,259 @@
+package drain
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const closeWriteTimeout = time.Second
+
+// Drainer keeps track of open websocket connections so they can be closed cleanly when the server shuts down.
+// http.Server.Shutdown doesn't wait for or close hijacked connections, so without it subscribers would just see the
+// connection drop.
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	conns    map[*trackedConn]struct{}
+}
+
+func New() *Drainer {
+	return &Drainer{
+		conns: map[*trackedConn]struct{}{},
+	}
+}
+
+// Middleware refuses new websocket connections once the server is draining and tracks the ones it lets through
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if d.Draining() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		if hijacker, ok := w.(http.Hijacker); ok {
+			w = &hijackTracker{ResponseWriter: w, hijacker: hijacker, drainer: d}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Ready fails once draining starts, so load balancers stop routing to the server before it goes away
+func (d *Drainer) Ready(ctx context.Context) error {
+	if d.Draining() {
+		return errors.New("server is shutting down")
+	}
+	return nil
+}
+
+// Drain stops accepting subscriptions and closes every open websocket with a service restart close code, which tells
+// clients to reconnect, to another replica if there is one. The subscriptions on a connection end once it's closed.
+func (d *Drainer) Drain() {
+	d.mu.Lock()
+	d.draining = true
+	conns := make([]*trackedConn, 0, len(d.conns))
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	d.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.closeWith(websocket.CloseServiceRestart, "server is restarting")
+	}
+}
+
+func (d *Drainer) add(conn *trackedConn) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.conns[conn] = struct{}{}
+	return true
+}
+
+func (d *Drainer) remove(conn *trackedConn) {
+	d.mu.Lock()
+	delete(d.conns, conn)
+	d.mu.Unlock()
+}
+
+type hijackTracker struct {
+	http.ResponseWriter
+	hijacker http.Hijacker
+	drainer  *Drainer
+}
+
+func (t *hijackTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := t.hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tracked := &trackedConn{Conn: conn, drainer: t.drainer}
+	if !t.drainer.add(tracked) {
+		conn.Close()
+		return nil, nil, errors.New("server is shutting down")
+	}
+	return tracked, rw, nil
+}
+
+// trackedConn serializes writes so a close frame can be sent while the websocket library is using the connection.
+// The library can split one frame across several writes, so the connection follows the frames going out and only
+// sends the close frame between two of them. gqlgen's websocket transport has no way to close a connection, and
+// cancelling its context would complete the subscriptions, which clients don't subscribe to again when they reconnect.
+type trackedConn struct {
+	net.Conn
+	drainer *Drainer
+	mu      sync.Mutex
+	frames  frameTracker
+	closing bool
+	//A close frame waiting for the frame being written to finish, and the channel to close once it's sent
+	pending []byte
+	sent    chan struct{}
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Write(b)
+	c.frames.advance(b[:n])
+	if c.pending != nil && c.frames.between() {
+		c.sendPending()
+	}
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	c.drainer.remove(c)
+	return c.Conn.Close()
+}
+
+// closeWith sends a close frame once the frame being written is done, giving up and just closing the connection if
+// that takes too long
+func (c *trackedConn) closeWith(code int, reason string) {
+	payload := websocket.FormatCloseMessage(code, reason)
+	//Server frames are never masked, and a short reason fits in one length byte
+	frame := append([]byte{0x88, byte(len(payload))}, payload...)
+
+	sent := make(chan struct{})
+	go func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closing {
+			close(sent)
+			return
+		}
+		c.pending, c.sent = frame, sent
+		if c.frames.between() {
+			c.sendPending()
+		}
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(closeWriteTimeout):
+	}
+	c.Close()
+}
+
+// sendPending writes the waiting close frame, after which nothing else can be written. c.mu has to be held.
+func (c *trackedConn) sendPending() {
+	c.Conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.Conn.Write(c.pending)
+	c.closing = true
+	c.pending = nil
+	close(c.sent)
+}
+
+// frameTracker follows the websocket frames written to a connection, starting after the handshake response
+type frameTracker struct {
+	upgraded bool
+	//The header of the frame being written, while it's incomplete
+	header []byte
+	//How many bytes of the current frame's payload are still to come
+	remaining uint64
+}
+
+// between is whether the bytes written so far end on a frame boundary
+func (f *frameTracker) between() bool {
+	return f.upgraded && len(f.header) == 0 && f.remaining == 0
+}
+
+func (f *frameTracker) advance(b []byte) {
+	//The library writes the whole handshake response at once
+	if !f.upgraded {
+		f.upgraded = len(b) > 0
+		return
+	}
+
+	for len(b) > 0 {
+		if f.remaining > 0 {
+			n := uint64(len(b))
+			if n > f.remaining {
+				n = f.remaining
+			}
+			f.remaining -= n
+			b = b[n:]
+			continue
+		}
+
+		f.header = append(f.header, b[0])
+		b = b[1:]
+		if size := headerSize(f.header); size > 0 && len(f.header) == size {
+			f.remaining = payloadLength(f.header)
+			f.header = f.header[:0]
+		}
+	}
+}
+
+// headerSize is the length of a frame header given its first bytes, or 0 if that isn't known yet
+func headerSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
+
+func payloadLength(header []byte) uint64 {
+	switch length := header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(header[2:10])
+	default:
+		return uint64(length)
+	}
+}
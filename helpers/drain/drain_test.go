@@ -0,0 +1,169 @@
+package drain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// frame builds a websocket frame header for a payload of the given length
+func frame(length int, masked bool) []byte {
+	header := []byte{0x81, 0}
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	if masked {
+		header[1] |= 0x80
+		header = append(header, 1, 2, 3, 4)
+	}
+	return header
+}
+
+func TestHeaderSizeAndPayloadLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		masked bool
+		size   int
+	}{
+		{"empty", 0, false, 2},
+		{"short", 125, false, 2},
+		{"16 bit length", 126, false, 4},
+		{"largest 16 bit length", 0xffff, false, 4},
+		{"64 bit length", 0x10000, false, 10},
+		{"masked short", 5, true, 6},
+		{"masked 16 bit length", 300, true, 8},
+		{"masked 64 bit length", 0x10000, true, 14},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := frame(test.length, test.masked)
+			if size := headerSize(header); size != test.size {
+				t.Errorf("got header size %d, want %d", size, test.size)
+			}
+			if length := payloadLength(header); length != uint64(test.length) {
+				t.Errorf("got payload length %d, want %d", length, test.length)
+			}
+		})
+	}
+
+	if size := headerSize([]byte{0x81}); size != 0 {
+		t.Errorf("got header size %d from one byte, want 0 until the length byte arrives", size)
+	}
+}
+
+func TestAdvanceFollowsSplitWrites(t *testing.T) {
+	var stream []byte
+	//Where each frame ends in the stream
+	boundaries := map[int]bool{}
+	for _, length := range []int{0, 10, 200, 0x10000, 3} {
+		stream = append(stream, frame(length, false)...)
+		stream = append(stream, bytes.Repeat([]byte{'x'}, length)...)
+		boundaries[len(stream)] = true
+	}
+
+	//Split the stream into two writes at points all through it, including inside headers and payloads
+	for split := 0; split <= len(stream); split += 97 {
+		f := frameTracker{}
+		f.advance([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+		if !f.between() {
+			t.Fatal("not between frames after the handshake")
+		}
+
+		f.advance(stream[:split])
+		if f.between() != (split == 0 || boundaries[split]) {
+			t.Errorf("after writing %d bytes, between is %v", split, f.between())
+		}
+		f.advance(stream[split:])
+		if !f.between() {
+			t.Errorf("split at %d: not between frames after the whole stream", split)
+		}
+	}
+
+	//And write it a byte at a time
+	f := frameTracker{}
+	f.advance([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+	for i := range stream {
+		f.advance(stream[i : i+1])
+		if f.between() != boundaries[i+1] {
+			t.Fatalf("after writing %d bytes one at a time, between is %v", i+1, f.between())
+		}
+	}
+}
+
+func TestAdvanceWaitsForHandshake(t *testing.T) {
+	f := frameTracker{}
+	if f.between() {
+		t.Error("between frames before the handshake was written")
+	}
+	f.advance(nil)
+	if f.between() {
+		t.Error("between frames after an empty write")
+	}
+}
+
+// TestDrainClosesBetweenFrames streams messages large enough that the websocket library splits them across writes
+// and checks the client gets every message intact, then the restart close code
+func TestDrainClosesBetweenFrames(t *testing.T) {
+	drainer := New()
+	upgrader := websocket.Upgrader{}
+	message := strings.Repeat("event ", 5000)
+
+	server := httptest.NewServer(drainer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		for {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				return
+			}
+		}
+	})))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	go drainer.Drain()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, received, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+				t.Fatalf("got %v, want a service restart close frame", err)
+			}
+			break
+		}
+		if string(received) != message {
+			t.Fatalf("got a %d byte message, want the %d bytes sent", len(received), len(message))
+		}
+	}
+
+	if !drainer.Draining() {
+		t.Error("not draining after Drain")
+	}
+	if _, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil); err == nil {
+		t.Error("a websocket connected while draining")
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+)
+
+// Address is where a new or updated event takes place, from its address or, for older clients, its deprecated
+// US address fields. Online events have no address.
+func Address(input model.NewEvent) model.PostalAddress {
+	if !Physical(input) {
+		return model.PostalAddress{}
+	}
+	if input.Address != nil {
+		return address.FromInput(*input.Address)
+	}
+	return address.FromLegacy(input.AddressLine1, input.AddressLine2, input.City, input.State, input.Zip)
+}
+
+// UsesLegacyAddress reports whether an input sets any of the deprecated address fields
+func UsesLegacyAddress(input model.NewEvent) bool {
+	return input.AddressLine1 != nil || input.AddressLine2 != nil || input.City != nil || input.State != nil || input.Zip != nil
+}
+
+// ZipKey is the zip code newEvents subscribers listen on for an event, or an empty string outside the US
+func ZipKey(eventAddress model.PostalAddress) string {
+	if zip := address.LegacyZip(eventAddress); zip != 0 {
+		return address.Zip(zip)
+	}
+	return ""
+}
+
+// InZip limits an events query to a US zip code, including addresses with ZIP+4 codes
+func InZip(db *gorm.DB, zip int, includeOnline bool) *gorm.DB {
+	return Located(db, includeOnline, "events.address_country_code = 'US' AND (events.address_postal_code = ? OR events.address_postal_code LIKE ?)",
+		address.Zip(zip), address.Zip(zip)+"-%")
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+)
+
+// transitions lists the statuses an event may move to from each status. COMPLETED is only reached through the completion job.
+var transitions = map[model.EventStatus][]model.EventStatus{
+	model.EventStatusDraft:     {model.EventStatusPublished, model.EventStatusCancelled},
+	model.EventStatusPublished: {model.EventStatusCancelled, model.EventStatusPostponed, model.EventStatusCompleted},
+	model.EventStatusPostponed: {model.EventStatusPublished, model.EventStatusCancelled, model.EventStatusPostponed, model.EventStatusCompleted},
+}
+
+func CanTransition(from model.EventStatus, to model.EventStatus) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+func Transition(event *model.Event, to model.EventStatus) error {
+	if !CanTransition(event.Status, to) {
+		return apperrors.Conflict("event can't be moved from " + event.Status.String() + " to " + to.String())
+	}
+	event.Status = to
+	return nil
+}
+
+// Visible scopes an events query to what the user is allowed to see. Drafts are only visible to their owner and staff.
+func Visible(db *gorm.DB, user *model.User, includeCancelled bool) *gorm.DB {
+	if user == nil {
+		db = db.Where("events.status <> ?", model.EventStatusDraft)
+	} else if !user.IsStaff {
+		db = db.Where("events.status <> ? OR events.owner_id = ?", model.EventStatusDraft, user.UUIDKey.ID)
+	}
+
+	if !includeCancelled {
+		db = db.Where("events.status <> ?", model.EventStatusCancelled)
+	}
+
+	return db
+}
+
+func CanView(user *model.User, event *model.Event) bool {
+	if event.Status != model.EventStatusDraft {
+		return true
+	}
+	return user != nil && (user.IsStaff || user.UUIDKey.ID == event.OwnerID)
+}
+
+func StatusMessage(event *model.Event) string {
+	switch event.Status {
+	case model.EventStatusPublished:
+		return event.Name + " is confirmed for " + event.StartDate.Format(time.RFC1123)
+	case model.EventStatusCancelled:
+		return event.Name + " has been cancelled: " + event.CancellationReason
+	case model.EventStatusPostponed:
+		return event.Name + " has been postponed to " + event.StartDate.Format(time.RFC1123)
+	case model.EventStatusCompleted:
+		return event.Name + " has ended. Thanks for coming!"
+	}
+	return event.Name + " has been updated"
+}
+
+// MaxNotifications caps how many notifications getNotifications returns, the newest first
+const MaxNotifications = 100
+
+// NotifyAttendees stores a notification about the event's current status for everyone attending it
+func NotifyAttendees(event *model.Event, db *gorm.DB) ([]*model.Notification, error) {
+	var attendees []*model.User
+
+	if err := db.Model(model.Event{
+		UUIDKey: event.UUIDKey,
+	}).Association("Users").Find(&attendees).Error; err != nil {
+		return nil, err
+	}
+
+	notifications := make([]*model.Notification, 0, len(attendees))
+	for _, attendee := range attendees {
+		notification := &model.Notification{
+			UserID:  attendee.UUIDKey.ID,
+			EventID: event.UUIDKey.ID,
+			Status:  event.Status,
+			Message: StatusMessage(event),
+		}
+		if err := db.Create(notification).Error; err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// CompletePastEvents marks every published or postponed event that has ended as completed. Events without an
+// end date are over once they've started. It's one update, so events cancelled or postponed meanwhile are left
+// alone, and when several servers run it at once only one of them gets each event back to notify about.
+func CompletePastEvents(db *gorm.DB) (completed []*model.Event, err error) {
+	now := time.Now()
+	err = db.Raw(`UPDATE events SET status = ?, updated_at = ?
+WHERE deleted_at IS NULL AND status IN (?)
+AND ((end_date > ? AND end_date < ?) OR ((end_date IS NULL OR end_date <= ?) AND start_date > ? AND start_date < ?))
+RETURNING *`,
+		model.EventStatusCompleted, now,
+		[]model.EventStatus{model.EventStatusPublished, model.EventStatusPostponed},
+		time.Time{}, now,
+		time.Time{}, time.Time{}, now,
+	).Scan(&completed).Error
+	return completed, err
+}
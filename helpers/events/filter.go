@@ -0,0 +1,128 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/spatial"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MaxInViewport caps how many events a viewport query returns, the soonest first. Maps showing more should zoom in.
+const MaxInViewport = 5000
+
+// NormalizeTags lowercases and trims tags and drops empty and repeated ones
+func NormalizeTags(tags []string) pq.StringArray {
+	normalized := pq.StringArray{}
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// InBounds limits an events query to a map viewport. A west edge greater than the east edge means the viewport crosses the antimeridian.
+// Online events have no place on the map, so they're only included when asked for.
+func InBounds(db *gorm.DB, bounds *model.BoundsInput, includeOnline bool) *gorm.DB {
+	longitude := "events.longitude BETWEEN ? AND ?"
+	if bounds.West > bounds.East {
+		longitude = "(events.longitude >= ? OR events.longitude <= ?)"
+	}
+
+	indexed, args := spatial.InBox(bounds.South, bounds.West, bounds.North, bounds.East)
+	args = append(args, bounds.South, bounds.North, bounds.West, bounds.East)
+	return Located(db, includeOnline, indexed+" AND events.latitude BETWEEN ? AND ? AND "+longitude, args...)
+}
+
+// Located limits an events query to events matching a spatial condition. Online events never match one, and are
+// either added to the results or left out of them depending on includeOnline.
+func Located(db *gorm.DB, includeOnline bool, where string, args ...interface{}) *gorm.DB {
+	if includeOnline {
+		return db.Where("("+where+") OR events.location_type = ?", append(args, model.LocationTypeOnline)...)
+	}
+	return db.Where("("+where+") AND events.location_type <> ?", append(args, model.LocationTypeOnline)...)
+}
+
+// Filtered limits an events query to events in any of the filter's categories and with any of its tags
+func Filtered(db *gorm.DB, filter *model.EventFilter) (*gorm.DB, error) {
+	if filter == nil {
+		return db, nil
+	}
+
+	db, err := InCategories(db, filter.CategoryIds, "filter", "categoryIds")
+	if err != nil {
+		return nil, err
+	}
+	return filterTags(db, filter.Tags), nil
+}
+
+// InCategories limits an events query to events in any of the categories. IDs that aren't UUIDs are reported as a
+// validation error of the input at path.
+func InCategories(db *gorm.DB, categoryIDs []string, path ...string) (*gorm.DB, error) {
+	if len(categoryIDs) == 0 {
+		return db, nil
+	}
+
+	ids := make([]uuid.UUID, len(categoryIDs))
+	for i, categoryID := range categoryIDs {
+		id, err := uuid.FromString(categoryID)
+		if err != nil {
+			return nil, apperrors.Validation(apperrors.Field("must be category IDs", path...))
+		}
+		ids[i] = id
+	}
+	return db.Where("events.category_id IN (?)", ids), nil
+}
+
+func filterTags(db *gorm.DB, tags []string) *gorm.DB {
+	if len(tags) == 0 {
+		return db
+	}
+	return db.Where("events.tags && ?", NormalizeTags(tags))
+}
+
+// Facets counts the events matched by the query per category and per tag. Each facet ignores its own part of the filter,
+// so the counts show what selecting another category or tag would add.
+func Facets(db *gorm.DB, filter *model.EventFilter) (*model.EventFacets, error) {
+	if filter == nil {
+		filter = &model.EventFilter{}
+	}
+	facets := &model.EventFacets{
+		Categories: []*model.FacetCount{},
+		Tags:       []*model.FacetCount{},
+	}
+
+	if err := filterTags(db.Model(&model.Event{}), filter.Tags).
+		Select("categories.id AS value, categories.name AS label, count(*) AS count").
+		Joins("JOIN categories ON categories.id = events.category_id AND categories.deleted_at IS NULL").
+		Group("categories.id, categories.name").
+		Order("count DESC, label").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+
+	byCategory, err := InCategories(db.Model(&model.Event{}), filter.CategoryIds, "filter", "categoryIds")
+	if err != nil {
+		return nil, err
+	}
+	if err := byCategory.
+		Select("tag AS value, tag AS label, count(*) AS count").
+		Joins("CROSS JOIN LATERAL unnest(events.tags) AS tag").
+		Group("tag").
+		Order("count DESC, label").
+		Scan(&facets.Tags).Error; err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/opaquee/EventMapAPI/graph/model"
+	uuid "github.com/satori/go.uuid"
+)
+
+// LocationType is how a new or updated event is attended, in person unless the input says otherwise
+func LocationType(input model.NewEvent) model.LocationType {
+	if input.LocationType == nil {
+		return model.LocationTypeInPerson
+	}
+	return *input.LocationType
+}
+
+// JoinURL is the link online attendees use to join an event, or an empty string for events held only in person
+func JoinURL(input model.NewEvent) string {
+	if input.JoinURL == nil {
+		return ""
+	}
+	return strings.TrimSpace(*input.JoinURL)
+}
+
+// Online reports whether an event has no place on the map
+func Online(event *model.Event) bool {
+	return event.LocationType == model.LocationTypeOnline
+}
+
+// Physical reports whether an input has an address, directly or through a venue
+func Physical(input model.NewEvent) bool {
+	return LocationType(input) != model.LocationTypeOnline
+}
+
+// CanJoin reports whether a user gets an event's join link. Its owner and staff do, and so do the users attending it.
+func CanJoin(user *model.User, event *model.Event, attending func(eventID uuid.UUID) (bool, error)) (bool, error) {
+	if event.JoinURL == "" || user == nil {
+		return false, nil
+	}
+	if user.UUIDKey.ID == event.OwnerID || user.IsStaff {
+		return true, nil
+	}
+	return attending(event.UUIDKey.ID)
+}
@@ -0,0 +1,197 @@
+package feeds
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/calendars"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
+	"github.com/opaquee/EventMapAPI/helpers/validate"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// MaxCalendarEvents caps the events in one calendar feed
+	MaxCalendarEvents = 1000
+	// historyDays is how far back calendar feeds go, so calendars keep recent events without listing every one ever held
+	historyDays = 90
+
+	calendarContentType = "text/calendar; charset=utf-8"
+)
+
+// Event serves a single event as an iCalendar file to add to a calendar. Drafts are only served to their owner
+// and staff, and the join link only to the people who get it in the API.
+func Event(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := auth.ForContext(ctx)
+
+		id, err := uuid.FromString(chi.URLParam(r, "id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		event := &model.Event{}
+		if err := tracing.WithContext(ctx, db).Where("id = ?", id).First(event).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				http.NotFound(w, r)
+			} else {
+				failed(w, r, err)
+			}
+			return
+		}
+		if !events.CanView(user, event) {
+			http.NotFound(w, r)
+			return
+		}
+
+		//Feeds are served outside GraphQL, so there are no per-operation loaders to check attendance with
+		canJoin, err := events.CanJoin(user, event, func(eventID uuid.UUID) (bool, error) {
+			var count int
+			err := tracing.WithContext(ctx, db).Table("user_events").
+				Where("user_id = ? AND event_id = ?", user.UUIDKey.ID, eventID).
+				Count(&count).Error
+			return count > 0, err
+		})
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+		organizers, err := organizers(tracing.WithContext(ctx, db), []*model.Event{event})
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+
+		cal := newCalendar(event.Name)
+		cal.event(event, organizers[event.OwnerID], canJoin)
+
+		w.Header().Set("Content-Disposition", `attachment; filename="`+event.UUIDKey.ID.String()+`.ics"`)
+		write(w, r, calendarContentType, false, cal.bytes())
+	}
+}
+
+// UserCalendar serves the feed a token belongs to, with the events its user attends and owns. The token in the
+// URL is the only credential, since calendar apps subscribing to a feed can't send any.
+func UserCalendar(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := tracing.WithContext(r.Context(), db)
+
+		feed, user, err := calendars.ForToken(db, chi.URLParam(r, "token"))
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				http.NotFound(w, r)
+			} else {
+				failed(w, r, err)
+			}
+			return
+		}
+
+		query := events.Visible(db, user, true).
+			Where("events.owner_id = ? OR events.id IN (SELECT event_id FROM user_events WHERE user_id = ?)", user.UUIDKey.ID, user.UUIDKey.ID)
+		found, err := recent(query)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+
+		var attendingIDs []uuid.UUID
+		if err := db.Table("user_events").Where("user_id = ?", user.UUIDKey.ID).Pluck("event_id", &attendingIDs).Error; err != nil {
+			failed(w, r, err)
+			return
+		}
+		attending := make(map[uuid.UUID]bool, len(attendingIDs))
+		for _, id := range attendingIDs {
+			attending[id] = true
+		}
+
+		organizers, err := organizers(db, found)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+
+		cal := newCalendar(feed.Name)
+		for _, event := range found {
+			canJoin, _ := events.CanJoin(user, event, func(eventID uuid.UUID) (bool, error) {
+				return attending[eventID], nil
+			})
+			cal.event(event, organizers[event.OwnerID], canJoin)
+		}
+
+		write(w, r, calendarContentType, true, cal.bytes())
+	}
+}
+
+// ZipCalendar serves a public feed of the events in a US zip code that anyone can subscribe to
+func ZipCalendar(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := tracing.WithContext(r.Context(), db)
+
+		zip, err := strconv.Atoi(chi.URLParam(r, "zip"))
+		v := &validate.Validator{}
+		v.Zip(zip)
+		if err != nil || v.Err() != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		found, err := recent(events.InZip(events.Visible(db, nil, true), zip, false))
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+		organizers, err := organizers(db, found)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+
+		cal := newCalendar("Events in " + address.Zip(zip))
+		for _, event := range found {
+			cal.event(event, organizers[event.OwnerID], false)
+		}
+
+		write(w, r, calendarContentType, false, cal.bytes())
+	}
+}
+
+// recent finds the events of a feed that started in the last few months or are still to come
+func recent(query *gorm.DB) ([]*model.Event, error) {
+	var found []*model.Event
+	err := query.Where("events.start_date >= ?", time.Now().AddDate(0, 0, -historyDays)).
+		Order("events.start_date").
+		Limit(MaxCalendarEvents).
+		Find(&found).Error
+	return found, err
+}
+
+// organizers loads the owners of events by ID in one query. Owners who deleted their account are left out.
+func organizers(db *gorm.DB, found []*model.Event) (map[uuid.UUID]*model.User, error) {
+	ids := make([]uuid.UUID, 0, len(found))
+	for _, event := range found {
+		ids = append(ids, event.OwnerID)
+	}
+
+	byID := map[uuid.UUID]*model.User{}
+	if len(ids) == 0 {
+		return byID, nil
+	}
+
+	var owners []*model.User
+	if err := db.Where("id IN (?)", ids).Find(&owners).Error; err != nil {
+		return nil, err
+	}
+	for _, owner := range owners {
+		byID[owner.UUIDKey.ID] = owner
+	}
+
+	return byID, nil
+}
@@ -0,0 +1,148 @@
+package feeds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jinzhu/gorm"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/jwt"
+	uuid "github.com/satori/go.uuid"
+)
+
+// open creates the columns of the users, events and user_events tables the handler reads
+func open(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	t.Cleanup(func() { db.Close() })
+	//Every connection to :memory: gets its own empty database
+	db.DB().SetMaxOpenConns(1)
+
+	exec(t, db, "CREATE TABLE users (id, deleted_at datetime, username, first_name, last_name, is_staff bool)")
+	exec(t, db, "CREATE TABLE events (id, deleted_at datetime, updated_at datetime, name, owner_id, status, start_date datetime, location_type, join_url)")
+	exec(t, db, "CREATE TABLE user_events (user_id, event_id)")
+	return db
+}
+
+func exec(t *testing.T, db *gorm.DB, sql string, values ...interface{}) {
+	t.Helper()
+	if err := db.Exec(sql, values...).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createUser(t *testing.T, db *gorm.DB, name string) *model.User {
+	t.Helper()
+	user := &model.User{UUIDKey: model.UUIDKey{ID: uuid.NewV4()}, FirstName: name, Username: name}
+	exec(t, db, "INSERT INTO users (id, username, first_name, is_staff) VALUES (?, ?, ?, false)", user.UUIDKey.ID, name, name)
+	return user
+}
+
+func createEvent(t *testing.T, db *gorm.DB, event *model.Event) {
+	t.Helper()
+	event.UUIDKey.ID = uuid.NewV4()
+	if event.LocationType == "" {
+		event.LocationType = model.LocationTypeInPerson
+	}
+	exec(t, db, "INSERT INTO events (id, name, owner_id, status, start_date, location_type, join_url) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		event.UUIDKey.ID, event.Name, event.OwnerID, event.Status, event.StartDate, event.LocationType, event.JoinURL)
+}
+
+// getEvent requests an event's calendar file through the same middleware and route the server uses
+func getEvent(t *testing.T, db *gorm.DB, event *model.Event, user *model.User) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := chi.NewRouter()
+	router.Use(auth.Middleware(db))
+	router.Get("/events/{id}.ics", Event(db))
+
+	r := httptest.NewRequest(http.MethodGet, "/events/"+event.UUIDKey.ID.String()+".ics", nil)
+	if user != nil {
+		token, err := jwt.GenerateToken(user.Username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestEventCalendar(t *testing.T) {
+	jwt.Configure(config.JWT{Secret: "test", TokenTTL: time.Hour})
+	db := open(t)
+
+	owner := createUser(t, db, "owner")
+	attendee := createUser(t, db, "attendee")
+	stranger := createUser(t, db, "stranger")
+
+	event := &model.Event{
+		Name:         "Launch party",
+		OwnerID:      owner.UUIDKey.ID,
+		Status:       model.EventStatusPublished,
+		StartDate:    time.Now().Add(24 * time.Hour),
+		LocationType: model.LocationTypeOnline,
+		JoinURL:      "https://example.com/join",
+	}
+	createEvent(t, db, event)
+	exec(t, db, "INSERT INTO user_events (user_id, event_id) VALUES (?, ?)", attendee.UUIDKey.ID, event.UUIDKey.ID)
+
+	tests := []struct {
+		name     string
+		user     *model.User
+		joinLink bool
+	}{
+		{"anonymous", nil, false},
+		{"stranger", stranger, false},
+		{"attendee", attendee, true},
+		{"owner", owner, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getEvent(t, db, event, test.user)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != calendarContentType {
+				t.Errorf("got content type %q, want %q", contentType, calendarContentType)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, "SUMMARY:Launch party\r\n") {
+				t.Errorf("calendar is missing the event:\n%s", body)
+			}
+			if joinLink := strings.Contains(body, "URL:"+event.JoinURL); joinLink != test.joinLink {
+				t.Errorf("calendar has the join link %v, want %v:\n%s", joinLink, test.joinLink, body)
+			}
+		})
+	}
+}
+
+func TestEventCalendarHidesDrafts(t *testing.T) {
+	jwt.Configure(config.JWT{Secret: "test", TokenTTL: time.Hour})
+	db := open(t)
+
+	owner := createUser(t, db, "owner")
+	stranger := createUser(t, db, "stranger")
+	draft := &model.Event{Name: "draft", OwnerID: owner.UUIDKey.ID, Status: model.EventStatusDraft, StartDate: time.Now()}
+	createEvent(t, db, draft)
+
+	if w := getEvent(t, db, draft, stranger); w.Code != http.StatusNotFound {
+		t.Errorf("a stranger got status %d for a draft, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := getEvent(t, db, draft, owner); w.Code != http.StatusOK {
+		t.Errorf("the owner got status %d for their draft, want %d", w.Code, http.StatusOK)
+	}
+}
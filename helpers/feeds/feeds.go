@@ -0,0 +1,91 @@
+package feeds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
+)
+
+// maxAge is how long clients and caches may reuse a feed. Events don't move often, but new ones should show up soon.
+const maxAge = 60 * time.Second
+
+// truncatedHeader is set on feeds that hit their feature cap, so clients know to zoom in or narrow the dates
+const truncatedHeader = "X-Features-Truncated"
+
+// inBox finds up to limit events a user may see in a box, starting between from and to when they're given, and
+// whether there were more. Without a from, completed events are left out, so past events can't crowd out the
+// upcoming ones. It goes through the same scopes as the viewport queries, so feeds and GraphQL clients see the
+// same events.
+func inBox(ctx context.Context, db *gorm.DB, bounds model.BoundsInput, from *time.Time, to *time.Time, limit int) ([]*model.Event, bool, error) {
+	query := events.Visible(tracing.WithContext(ctx, db), auth.ForContext(ctx), false)
+	query = events.InBounds(query, &bounds, false)
+	if from != nil {
+		query = query.Where("events.start_date >= ?", *from)
+	} else {
+		query = query.Where("events.status <> ?", model.EventStatusCompleted)
+	}
+	if to != nil {
+		query = query.Where("events.start_date <= ?", *to)
+	}
+
+	var found []*model.Event
+	if err := query.Order("events.start_date").Limit(limit + 1).Find(&found).Error; err != nil {
+		return nil, false, err
+	}
+	if len(found) > limit {
+		return found[:limit], true, nil
+	}
+	return found, false, nil
+}
+
+// parseTime reads an optional RFC 3339 time from the query string
+func parseTime(r *http.Request, name string) (*time.Time, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// write sends a feed with caching headers. Feeds depend on who's asking, since drafts are only visible to their
+// owners, so signed in users' copies and personal feeds are private. Clients that already have the same body get a 304.
+func write(w http.ResponseWriter, r *http.Request, contentType string, private bool, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	cacheControl := "public"
+	if private || auth.ForContext(r.Context()) != nil {
+		cacheControl = "private"
+	}
+	w.Header().Set("Cache-Control", cacheControl+", max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	w.Header().Set("Vary", "Authorization")
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func failed(w http.ResponseWriter, r *http.Request, err error) {
+	//The path isn't logged, since calendar feed paths hold their token
+	logging.For(r.Context()).Error("building feed failed", "error", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
@@ -0,0 +1,125 @@
+package feeds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+)
+
+// MaxFeatures caps how many events one GeoJSON response carries. Clients showing more should zoom in or use tiles.
+const MaxFeatures = 5000
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   Point                  `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type Point struct {
+	Type string `json:"type"`
+	// Coordinates are longitude then latitude, the GeoJSON order
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// properties are the fields map clients style and label events with, shared by GeoJSON features and tiles
+func properties(event *model.Event) map[string]interface{} {
+	props := map[string]interface{}{
+		"id":           event.UUIDKey.ID.String(),
+		"name":         event.Name,
+		"startDate":    event.StartDate.UTC().Format(time.RFC3339),
+		"endDate":      event.EndDate.UTC().Format(time.RFC3339),
+		"status":       string(event.Status),
+		"locationType": string(event.LocationType),
+	}
+	if event.CategoryID != nil {
+		props["categoryId"] = event.CategoryID.String()
+	}
+	if event.VenueID != nil {
+		props["venueId"] = event.VenueID.String()
+	}
+	if len(event.Tags) > 0 {
+		props["tags"] = strings.Join(event.Tags, ",")
+	}
+	return props
+}
+
+// GeoJSON serves the events in a bbox of west,south,east,north as a FeatureCollection, optionally only those
+// starting between from and to
+func GeoJSON(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bounds, ok := parseBBox(r.URL.Query().Get("bbox"))
+		if !ok {
+			http.Error(w, "bbox must be west,south,east,north in degrees", http.StatusBadRequest)
+			return
+		}
+		from, ok := parseTime(r, "from")
+		if !ok {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		to, ok := parseTime(r, "to")
+		if !ok {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+
+		found, truncated, err := inBox(r.Context(), db, bounds, from, to, MaxFeatures)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+		if truncated {
+			w.Header().Set(truncatedHeader, "true")
+		}
+
+		collection := FeatureCollection{Type: "FeatureCollection", Features: make([]*Feature, len(found))}
+		for i, event := range found {
+			collection.Features[i] = &Feature{
+				Type:       "Feature",
+				ID:         event.UUIDKey.ID.String(),
+				Geometry:   Point{Type: "Point", Coordinates: [2]float64{event.Longitude, event.Latitude}},
+				Properties: properties(event),
+			}
+		}
+
+		body, err := json.Marshal(collection)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+		write(w, r, "application/geo+json", false, body)
+	}
+}
+
+// parseBBox reads a bounding box in the GeoJSON order. A west edge greater than the east edge crosses the antimeridian.
+func parseBBox(raw string) (model.BoundsInput, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return model.BoundsInput{}, false
+	}
+
+	edges := make([]float64, 4)
+	for i, part := range parts {
+		edge, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return model.BoundsInput{}, false
+		}
+		edges[i] = edge
+	}
+
+	bounds := model.BoundsInput{West: edges[0], South: edges[1], East: edges[2], North: edges[3]}
+	valid := bounds.South >= -90 && bounds.North <= 90 && bounds.South <= bounds.North &&
+		bounds.West >= -180 && bounds.West <= 180 && bounds.East >= -180 && bounds.East <= 180
+	return bounds, valid
+}
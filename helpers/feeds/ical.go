@@ -0,0 +1,140 @@
+package feeds
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+)
+
+const (
+	// refreshInterval is how often calendar apps are asked to check subscribed feeds for changes
+	refreshInterval = "PT1H"
+
+	icalTime = "20060102T150405Z"
+	//Lines longer than this many bytes are folded onto continuation lines
+	maxLineLength = 75
+)
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// calendar writes an iCalendar (RFC 5545) document
+type calendar struct {
+	b strings.Builder
+}
+
+func newCalendar(name string) *calendar {
+	c := &calendar{}
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//EventMap//EventMapAPI//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.line("X-WR-CALNAME", text(name))
+	c.line("REFRESH-INTERVAL;VALUE=DURATION", refreshInterval)
+	c.line("X-PUBLISHED-TTL", refreshInterval)
+	return c
+}
+
+// line writes a content line, folding it so no line is longer than 75 bytes without splitting a character
+func (c *calendar) line(name string, value string) {
+	content := name + ":" + value
+	limit := maxLineLength
+	for len(content) > limit {
+		cut := limit
+		for !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		c.b.WriteString(content[:cut] + "\r\n ")
+		content = content[cut:]
+		//The space starting a continuation line counts towards its length
+		limit = maxLineLength - 1
+	}
+	c.b.WriteString(content + "\r\n")
+}
+
+// event writes an event. Events without a start date can't be put on a calendar and are skipped. The join link of
+// online and hybrid events is only written when canJoin is set.
+func (c *calendar) event(event *model.Event, organizer *model.User, canJoin bool) {
+	if event.StartDate.IsZero() {
+		return
+	}
+
+	c.line("BEGIN", "VEVENT")
+	c.line("UID", event.UUIDKey.ID.String()+"@eventmap")
+	c.line("DTSTAMP", event.UpdatedAt.UTC().Format(icalTime))
+	c.line("LAST-MODIFIED", event.UpdatedAt.UTC().Format(icalTime))
+	c.line("DTSTART", event.StartDate.UTC().Format(icalTime))
+	if event.EndDate.After(event.StartDate) {
+		c.line("DTEND", event.EndDate.UTC().Format(icalTime))
+	}
+	c.line("SUMMARY", text(event.Name))
+
+	description := event.Description
+	if canJoin && event.JoinURL != "" {
+		description = strings.TrimSpace(description + "\n\nJoin online: " + event.JoinURL)
+		c.line("URL", event.JoinURL)
+	}
+	if description != "" {
+		c.line("DESCRIPTION", text(description))
+	}
+
+	if events.Online(event) {
+		c.line("LOCATION", "Online")
+	} else {
+		c.line("LOCATION", text(strings.Join(address.FormatLines(event.Address), ", ")))
+		c.line("GEO", strconv.FormatFloat(event.Latitude, 'f', 6, 64)+";"+strconv.FormatFloat(event.Longitude, 'f', 6, 64))
+	}
+
+	//Emails are private, so organizers are identified by their user ID instead of a mailto address
+	if organizer != nil {
+		name := param(strings.TrimSpace(organizer.FirstName + " " + organizer.LastName))
+		c.line(`ORGANIZER;CN="`+name+`"`, "urn:uuid:"+organizer.UUIDKey.ID.String())
+	}
+	if len(event.Tags) > 0 {
+		tags := make([]string, len(event.Tags))
+		for i, tag := range event.Tags {
+			tags[i] = text(tag)
+		}
+		c.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	c.line("STATUS", status(event.Status))
+	c.line("END", "VEVENT")
+}
+
+func (c *calendar) bytes() []byte {
+	c.line("END", "VCALENDAR")
+	return []byte(c.b.String())
+}
+
+// text escapes a TEXT value
+func text(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// param makes s safe to quote as a parameter value, which can't hold double quotes or control characters
+func param(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// status maps an event's status onto the ones calendars know. Calendar apps drop or strike through cancelled events,
+// so feeds keep listing them.
+func status(eventStatus model.EventStatus) string {
+	switch eventStatus {
+	case model.EventStatusCancelled:
+		return "CANCELLED"
+	case model.EventStatusDraft, model.EventStatusPostponed:
+		return "TENTATIVE"
+	default:
+		return "CONFIRMED"
+	}
+}
@@ -0,0 +1,183 @@
+package feeds
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	MaxZoom = 22
+	// MaxTileFeatures caps the events in one tile, which only matters for tiles zoomed far out
+	MaxTileFeatures = 2000
+
+	// maxLatitude is where Web Mercator ends, the latitude that makes the world square
+	maxLatitude = 85.0511287798
+
+	eventsLayer = "events"
+	extent      = 4096
+	//Points just outside a tile are included too, so markers on the edge aren't cut off by the tile next to them
+	buffer = 64
+)
+
+// Field numbers and values from version 2 of the Mapbox Vector Tile spec's vector_tile.proto
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+	layerVersion  = 15
+
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+
+	geomTypePoint = 1
+	commandMoveTo = 1
+)
+
+// Tile serves the events in tile z/x/y, in the XYZ scheme web maps use, as a Mapbox Vector Tile with one layer
+// of event points carrying the same properties as GeoJSON features
+func Tile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		z, errZ := strconv.Atoi(chi.URLParam(r, "z"))
+		x, errX := strconv.Atoi(chi.URLParam(r, "x"))
+		y, errY := strconv.Atoi(chi.URLParam(r, "y"))
+		tiles := 1 << uint(z)
+		if errZ != nil || errX != nil || errY != nil || z < 0 || z > MaxZoom || x < 0 || x >= tiles || y < 0 || y >= tiles {
+			http.Error(w, "no such tile", http.StatusNotFound)
+			return
+		}
+
+		found, truncated, err := inBox(r.Context(), db, tileBounds(z, x, y), nil, nil, MaxTileFeatures)
+		if err != nil {
+			failed(w, r, err)
+			return
+		}
+		if truncated {
+			w.Header().Set(truncatedHeader, "true")
+		}
+
+		write(w, r, "application/vnd.mapbox-vector-tile", false, encodeTile(z, x, y, found))
+	}
+}
+
+// tileX and tileY project a point into the world at zoom z, measured in tiles from the top left. Points nearer the
+// poles than Web Mercator reaches are put on its edge.
+func tileX(longitude float64, z int) float64 {
+	return (longitude + 180) / 360 * float64(int(1)<<uint(z))
+}
+
+func tileY(latitude float64, z int) float64 {
+	radians := math.Max(-maxLatitude, math.Min(maxLatitude, latitude)) * math.Pi / 180
+	return (1 - math.Log(math.Tan(radians)+1/math.Cos(radians))/math.Pi) / 2 * float64(int(1)<<uint(z))
+}
+
+func tileLongitude(x float64, z int) float64 {
+	return x/float64(int(1)<<uint(z))*360 - 180
+}
+
+func tileLatitude(y float64, z int) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/float64(int(1)<<uint(z))))) * 180 / math.Pi
+}
+
+// tileBounds is the area a tile and its buffer cover. Web Mercator stops short of the poles at about 85 degrees.
+func tileBounds(z int, x int, y int) model.BoundsInput {
+	margin := float64(buffer) / extent
+	bounds := model.BoundsInput{
+		West:  math.Max(-180, tileLongitude(float64(x)-margin, z)),
+		East:  math.Min(180, tileLongitude(float64(x+1)+margin, z)),
+		North: tileLatitude(float64(y)-margin, z),
+		South: tileLatitude(float64(y+1)+margin, z),
+	}
+	if y == 0 {
+		bounds.North = 90
+	}
+	if y == 1<<uint(z)-1 {
+		bounds.South = -90
+	}
+	return bounds
+}
+
+// encodeTile writes the events as points of a single layer. Each property key and value is stored once in the
+// layer and referenced by index from the features.
+func encodeTile(z int, x int, y int, found []*model.Event) []byte {
+	var keys, values []string
+	keyIndex, valueIndex := map[string]uint64{}, map[string]uint64{}
+	index := func(s string, list *[]string, indexes map[string]uint64) uint64 {
+		if i, ok := indexes[s]; ok {
+			return i
+		}
+		indexes[s] = uint64(len(*list))
+		*list = append(*list, s)
+		return indexes[s]
+	}
+
+	var layer []byte
+	layer = protowire.AppendTag(layer, layerVersion, protowire.VarintType)
+	layer = protowire.AppendVarint(layer, 2)
+	layer = protowire.AppendTag(layer, layerName, protowire.BytesType)
+	layer = protowire.AppendString(layer, eventsLayer)
+
+	for _, event := range found {
+		props := properties(event)
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var tags []byte
+		for _, name := range names {
+			tags = protowire.AppendVarint(tags, index(name, &keys, keyIndex))
+			tags = protowire.AppendVarint(tags, index(props[name].(string), &values, valueIndex))
+		}
+
+		px := int64(math.Round((tileX(event.Longitude, z) - float64(x)) * extent))
+		py := int64(math.Round((tileY(event.Latitude, z) - float64(y)) * extent))
+		var geometry []byte
+		geometry = protowire.AppendVarint(geometry, commandMoveTo|1<<3)
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(px))
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(py))
+
+		var feature []byte
+		feature = protowire.AppendTag(feature, featureTags, protowire.BytesType)
+		feature = protowire.AppendBytes(feature, tags)
+		feature = protowire.AppendTag(feature, featureType, protowire.VarintType)
+		feature = protowire.AppendVarint(feature, geomTypePoint)
+		feature = protowire.AppendTag(feature, featureGeometry, protowire.BytesType)
+		feature = protowire.AppendBytes(feature, geometry)
+
+		layer = protowire.AppendTag(layer, layerFeatures, protowire.BytesType)
+		layer = protowire.AppendBytes(layer, feature)
+	}
+
+	for _, key := range keys {
+		layer = protowire.AppendTag(layer, layerKeys, protowire.BytesType)
+		layer = protowire.AppendString(layer, key)
+	}
+	for _, value := range values {
+		var encoded []byte
+		encoded = protowire.AppendTag(encoded, valueString, protowire.BytesType)
+		encoded = protowire.AppendString(encoded, value)
+		layer = protowire.AppendTag(layer, layerValues, protowire.BytesType)
+		layer = protowire.AppendBytes(layer, encoded)
+	}
+	layer = protowire.AppendTag(layer, layerExtent, protowire.VarintType)
+	layer = protowire.AppendVarint(layer, extent)
+
+	var tile []byte
+	tile = protowire.AppendTag(tile, tileLayers, protowire.BytesType)
+	return protowire.AppendBytes(tile, layer)
+}
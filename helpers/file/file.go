@@ -5,8 +5,20 @@ import (
 	"strings"
 
 	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/config"
 )
 
+var uploadsDir string
+
+func Configure(cfg config.Uploads) {
+	uploadsDir = cfg.Dir
+}
+
+// Path is where an uploaded file with the given name is stored
+func Path(name string) string {
+	return uploadsDir + name
+}
+
 func ValidImageFile(filename string) (bool, error) {
 	var validImgExt = []string{"bmp", "jpeg", "jpg", "png"}
 
@@ -0,0 +1,41 @@
+package geocode
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/opaquee/EventMapAPI/helpers/metrics"
+)
+
+// cache remembers the geocoder's answers for a while, since addresses rarely move and every lookup spends quota.
+// Failed lookups aren't cached, so they're retried.
+var (
+	cache    graphql.Cache = lru.New(10000)
+	cacheTTL               = 24 * time.Hour
+)
+
+type cacheEntry struct {
+	data    *ResponseData
+	expires time.Time
+}
+
+func cached(ctx context.Context, key string) (*ResponseData, bool) {
+	if value, ok := cache.Get(ctx, key); ok {
+		if entry := value.(cacheEntry); time.Now().Before(entry.expires) {
+			metrics.GeocoderCacheLookups.WithLabelValues("hit").Inc()
+			return entry.data, true
+		}
+	}
+
+	metrics.GeocoderCacheLookups.WithLabelValues("miss").Inc()
+	return nil, false
+}
+
+func store(ctx context.Context, key string, data *ResponseData) {
+	cache.Add(ctx, key, cacheEntry{
+		data:    data,
+		expires: time.Now().Add(cacheTTL),
+	})
+}
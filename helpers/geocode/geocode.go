@@ -2,57 +2,293 @@ package geocode
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/lru"
 
 	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/metrics"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
+)
+
+const (
+	//Shorter prefixes match too much to be useful
+	MinPrefixLength    = 3
+	DefaultSuggestions = 5
+	MaxSuggestions     = 10
+)
+
+const (
+	forward_geo string = "v1/forward"
+	reverse_geo string = "v1/reverse"
+
+	//Suggestions are picked from this many results, so sorting them by distance has some to choose from
+	suggestionCandidates = 10
 )
 
-const geo_api_url string = "http://api.positionstack.com"
-const forward_geo string = "v1/forward"
+var (
+	geo_api_url    string
+	apiKey         string
+	checkReachable bool
+	client         = http.DefaultClient
+)
+
+func Configure(cfg config.Geocoder) {
+	geo_api_url = cfg.URL
+	apiKey = cfg.APIKey
+	checkReachable = cfg.CheckReachable
+	client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: tracing.Transport(http.DefaultTransport),
+	}
+	cache = lru.New(cfg.CacheSize)
+	cacheTTL = cfg.CacheTTL
+}
+
+// Ready checks the geocoder is configured and answering, when readiness is set to depend on it. Any response short
+// of a server error counts, since the check doesn't spend a lookup.
+func Ready(ctx context.Context) error {
+	if !checkReachable {
+		return nil
+	}
+	if apiKey == "" {
+		return errors.New("no geocoder API key is configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, geo_api_url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("geocoder responded with %s", res.Status)
+	}
+	return nil
+}
 
 type ResponseData struct {
 	Data []ResponseDataEntry `json:"data,omitempty"`
 }
 
 type ResponseDataEntry struct {
-	Latitude  float64 `json:"latitude,omitempty"`
-	Longitude float64 `json:"longitude,omitempty"`
+	Latitude      float64       `json:"latitude,omitempty"`
+	Longitude     float64       `json:"longitude,omitempty"`
+	Label         string        `json:"label,omitempty"`
+	Name          string        `json:"name,omitempty"`
+	Number        string        `json:"number,omitempty"`
+	Street        string        `json:"street,omitempty"`
+	PostalCode    string        `json:"postal_code,omitempty"`
+	Region        string        `json:"region,omitempty"`
+	RegionCode    string        `json:"region_code,omitempty"`
+	Locality      string        `json:"locality,omitempty"`
+	CountryModule CountryModule `json:"country_module,omitempty"`
 }
 
-func GetLatLng(event *model.Event) error {
-	baseURL, err := url.Parse(geo_api_url)
+// CountryModule is the extra country information positionstack sends when asked for it, which is the only place
+// it gives the two letter country code addresses are stored with
+type CountryModule struct {
+	CodeAlpha2 string `json:"code_alpha2,omitempty"`
+}
+
+// Address is the postal address of a result. Regions are stored as codes in countries that have a list of them.
+func (entry ResponseDataEntry) Address() model.PostalAddress {
+	postalAddress := model.PostalAddress{
+		CountryCode: entry.CountryModule.CodeAlpha2,
+		PostalCode:  entry.PostalCode,
+		Region:      entry.Region,
+		Locality:    entry.Locality,
+	}
+	if rules, ok := address.Countries[strings.ToUpper(postalAddress.CountryCode)]; ok && rules.Regions != nil && entry.RegionCode != "" {
+		postalAddress.Region = entry.RegionCode
+	}
+
+	//Results for landmarks only have a name
+	line := strings.TrimSpace(entry.Number + " " + entry.Street)
+	if line == "" && entry.Name != entry.Locality {
+		line = entry.Name
+	}
+	if line != "" {
+		postalAddress.Lines = []string{line}
+	}
+
+	return address.Normalize(postalAddress)
+}
+
+func GetLatLng(ctx context.Context, event *model.Event) error {
+	latitude, longitude, err := Locate(ctx, event.Address)
 	if err != nil {
 		return err
 	}
 
-	baseURL.Path += forward_geo
+	event.Latitude = latitude
+	event.Longitude = longitude
+
+	return nil
+}
+
+// GetAddress places an event at a point a user dropped a pin on, filling in its address by reverse geocoding
+func GetAddress(ctx context.Context, event *model.Event, location model.LocationInput) error {
+	postalAddress, err := Reverse(ctx, location.Latitude, location.Longitude)
+	if err != nil {
+		return err
+	}
+	if postalAddress == nil {
+		return apperrors.Validation(apperrors.Field("no address could be found here", "input", "location"))
+	}
+
+	event.Address = *postalAddress
+	event.Latitude = location.Latitude
+	event.Longitude = location.Longitude
+
+	return nil
+}
+
+// Locate looks up the coordinates of an address
+func Locate(ctx context.Context, postalAddress model.PostalAddress) (latitude float64, longitude float64, err error) {
+	params := url.Values{}
+	params.Add("query", address.Query(postalAddress))
+	params.Add("country", postalAddress.CountryCode)
+	params.Add("limit", "1")
+
+	res_data, err := lookup(ctx, forward_geo, params)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res_data.Data) == 0 {
+		metrics.GeocoderFailures.WithLabelValues("no_results").Inc()
+		return 0, 0, apperrors.Invalid("address couldn't be found")
+	}
+
+	return res_data.Data[0].Latitude, res_data.Data[0].Longitude, nil
+}
 
+// Reverse looks up the address closest to a point. It returns nil when there's none, like out at sea.
+func Reverse(ctx context.Context, latitude float64, longitude float64) (*model.PostalAddress, error) {
 	params := url.Values{}
-	params.Add("access_key", os.Getenv("GEO_API_KEY"))
-	params.Add("query", event.AddressLine1+", "+event.City+", "+event.State+", "+string(event.Zip))
-	params.Add("output", "json")
+	//Rounding to about ten meters lets nearby pins share a cache entry
+	params.Add("query", fmt.Sprintf("%.4f,%.4f", latitude, longitude))
 	params.Add("limit", "1")
 
+	res_data, err := lookup(ctx, reverse_geo, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range res_data.Data {
+		if postalAddress := entry.Address(); postalAddress.CountryCode != "" {
+			return &postalAddress, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Suggest looks up addresses starting with prefix. When near is given the closest come first, otherwise they
+// keep the geocoder's order.
+func Suggest(ctx context.Context, prefix string, near *model.LocationInput, limit int) ([]*model.AddressSuggestion, error) {
+	params := url.Values{}
+	params.Add("query", strings.ToLower(strings.Join(strings.Fields(prefix), " ")))
+	params.Add("limit", strconv.Itoa(suggestionCandidates))
+
+	res_data, err := lookup(ctx, forward_geo, params)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append([]ResponseDataEntry{}, res_data.Data...)
+	if near != nil {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return distanceKm(*near, entries[i]) < distanceKm(*near, entries[j])
+		})
+	}
+
+	suggestions := []*model.AddressSuggestion{}
+	for _, entry := range entries {
+		if len(suggestions) == limit {
+			break
+		}
+		postalAddress := entry.Address()
+		if postalAddress.CountryCode == "" {
+			continue
+		}
+		suggestions = append(suggestions, &model.AddressSuggestion{
+			Label:     entry.Label,
+			Address:   &postalAddress,
+			Latitude:  entry.Latitude,
+			Longitude: entry.Longitude,
+		})
+	}
+
+	return suggestions, nil
+}
+
+// distanceKm is the great-circle distance from a point to a result
+func distanceKm(from model.LocationInput, entry ResponseDataEntry) float64 {
+	lat1, lat2 := from.Latitude*math.Pi/180, entry.Latitude*math.Pi/180
+	dLng := (entry.Longitude - from.Longitude) * math.Pi / 180
+	return 6371 * math.Acos(math.Min(1, math.Cos(lat1)*math.Cos(lat2)*math.Cos(dLng)+math.Sin(lat1)*math.Sin(lat2)))
+}
+
+// lookup sends a query to one of the geocoder's endpoints, unless the same query was answered recently
+func lookup(ctx context.Context, endpoint string, params url.Values) (*ResponseData, error) {
+	key := endpoint + "?" + params.Encode()
+	if res_data, ok := cached(ctx, key); ok {
+		return res_data, nil
+	}
+
+	baseURL, err := url.Parse(geo_api_url)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL.Path += "/" + endpoint
+
+	params.Add("access_key", apiKey)
+	params.Add("output", "json")
+	params.Add("country_module", "1")
+
 	baseURL.RawQuery = params.Encode()
 
-	req, err := http.NewRequest("GET", baseURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL.String(), nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	res, err := http.DefaultClient.Do(req)
-	defer res.Body.Close()
+	start := time.Now()
+	res, err := client.Do(req)
 	if err != nil {
-		return err
+		metrics.GeocoderFailures.WithLabelValues("request").Inc()
+		return nil, err
 	}
+	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
+	metrics.GeocoderDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		return err
+		metrics.GeocoderFailures.WithLabelValues("request").Inc()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		metrics.GeocoderFailures.WithLabelValues("status").Inc()
+		return nil, fmt.Errorf("geocoder responded with %s", res.Status)
 	}
 
 	reader := bytes.NewReader(body)
@@ -60,11 +296,10 @@ func GetLatLng(event *model.Event) error {
 	res_data := &ResponseData{}
 
 	if err = decoder.Decode(res_data); err != nil {
-		return err
+		metrics.GeocoderFailures.WithLabelValues("decode").Inc()
+		return nil, err
 	}
 
-	event.Latitude = res_data.Data[0].Latitude
-	event.Longitude = res_data.Data[0].Longitude
-
-	return nil
+	store(ctx, key, res_data)
+	return res_data, nil
 }
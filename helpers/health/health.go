@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Check reports why a dependency isn't usable, or nil if it is
+type Check func(ctx context.Context) error
+
+// Live answers liveness probes. It only shows the process is serving requests, so orchestrators restart it when it
+// hangs but not when a dependency is down.
+func Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Ready answers readiness probes by running every check, each with its own timeout. It responds 503 with the failing
+// checks until all of them pass, so traffic is only routed to the server once it can handle it.
+type Ready struct {
+	Checks  map[string]Check
+	Timeout time.Duration
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (ready Ready) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(ready.Checks))
+	for name := range ready.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]error, len(names))
+	done := make(chan struct{})
+	for i, name := range names {
+		go func(i int, check Check) {
+			ctx, cancel := context.WithTimeout(r.Context(), ready.Timeout)
+			defer cancel()
+			results[i] = check(ctx)
+			done <- struct{}{}
+		}(i, ready.Checks[name])
+	}
+	for range names {
+		<-done
+	}
+
+	body := report{Status: "ok", Checks: map[string]string{}}
+	for i, name := range names {
+		if results[i] != nil {
+			body.Status = "unavailable"
+			body.Checks[name] = results[i].Error()
+		} else {
+			body.Checks[name] = "ok"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if body.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+// Database checks the server can still reach the database
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	}
+}
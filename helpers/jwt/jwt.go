@@ -5,17 +5,24 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/opaquee/EventMapAPI/helpers/config"
 )
 
 var (
-	SecretKey = []byte("secret")
+	SecretKey []byte
+	tokenTTL  = time.Hour
 )
 
+func Configure(cfg config.JWT) {
+	SecretKey = []byte(cfg.Secret)
+	tokenTTL = cfg.TokenTTL
+}
+
 func GenerateToken(username string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["username"] = username
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
+	claims["exp"] = time.Now().Add(tokenTTL).Unix()
 
 	tokenString, err := token.SignedString(SecretKey)
 
@@ -0,0 +1,119 @@
+package loaders
+
+import (
+	"sync"
+	"time"
+)
+
+// fetchFunc loads the values for a batch of keys. It returns one value per key in the same order, and either one
+// error per key or a single error for the whole batch.
+type fetchFunc func(keys []interface{}) ([]interface{}, []error)
+
+// Loader collects the keys requested within a short wait into one batch, fetches them together and caches the
+// results for the rest of the request
+type Loader struct {
+	fetch    fetchFunc
+	wait     time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	cache map[interface{}]interface{}
+	batch *batch
+}
+
+type batch struct {
+	keys    []interface{}
+	data    []interface{}
+	errors  []error
+	closing bool
+	done    chan struct{}
+}
+
+func newLoader(fetch fetchFunc) *Loader {
+	return &Loader{
+		fetch:    fetch,
+		wait:     time.Millisecond,
+		maxBatch: 100,
+		cache:    map[interface{}]interface{}{},
+	}
+}
+
+func (l *Loader) Load(key interface{}) (interface{}, error) {
+	l.mu.Lock()
+	if value, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return value, nil
+	}
+	if l.batch == nil {
+		l.batch = &batch{done: make(chan struct{})}
+	}
+	b := l.batch
+	pos := b.keyIndex(l, key)
+	l.mu.Unlock()
+
+	<-b.done
+
+	var err error
+	if len(b.errors) == 1 {
+		err = b.errors[0]
+	} else if b.errors != nil {
+		err = b.errors[pos]
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.cache[key] = b.data[pos]
+	l.mu.Unlock()
+
+	return b.data[pos], nil
+}
+
+// keyIndex adds the key to the batch if it isn't there yet and returns its position. The first key starts the wait
+// timer, and a full batch is sent off straight away.
+func (b *batch) keyIndex(l *Loader, key interface{}) int {
+	for i, existing := range b.keys {
+		if existing == key {
+			return i
+		}
+	}
+
+	pos := len(b.keys)
+	b.keys = append(b.keys, key)
+	if pos == 0 {
+		go b.startTimer(l)
+	}
+
+	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
+		if !b.closing {
+			b.closing = true
+			l.batch = nil
+			go b.end(l)
+		}
+	}
+
+	return pos
+}
+
+func (b *batch) startTimer(l *Loader) {
+	time.Sleep(l.wait)
+	l.mu.Lock()
+
+	// The batch filled up and was sent off while we were waiting
+	if b.closing {
+		l.mu.Unlock()
+		return
+	}
+
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.end(l)
+}
+
+func (b *batch) end(l *Loader) {
+	b.data, b.errors = l.fetch(b.keys)
+	close(b.done)
+}
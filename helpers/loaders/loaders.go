@@ -0,0 +1,402 @@
+package loaders
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
+	uuid "github.com/satori/go.uuid"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var loadersCtxKey = &contextKey{"loaders"}
+
+type contextKey struct {
+	name string
+}
+
+// Loaders batch the lookups resolvers make once per parent object. They live for a single operation, so their
+// caches never serve data across users or go stale over a websocket connection.
+type Loaders struct {
+	users           *Loader
+	venues          *Loader
+	eventUsers      *Loader
+	attendingEvents *Loader
+	ownedEvents     *Loader
+	attending       *Loader
+}
+
+// Extension installs a fresh set of loaders for every operation. Websocket connections carry many operations, so
+// this can't happen per HTTP request. Subscriptions get new loaders for every event they send.
+// The event loaders only return events the requesting user may see, so the auth middleware has to run first.
+type Extension struct {
+	DB *gorm.DB
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = Extension{}
+
+// current holds an operation's loaders. Subscription resolvers keep the context of the operation that started them,
+// so the loaders are swapped inside it rather than put in a new context for each response.
+type current struct {
+	loaders atomic.Pointer[Loaders]
+}
+
+func (Extension) ExtensionName() string {
+	return "Loaders"
+}
+
+func (Extension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	c := &current{}
+	c.loaders.Store(New(tracing.WithContext(ctx, e.DB), auth.ForContext(ctx)))
+	return next(context.WithValue(ctx, loadersCtxKey, c))
+}
+
+func (e Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if c, ok := ctx.Value(loadersCtxKey).(*current); ok && graphql.GetOperationContext(ctx).Operation.Operation == ast.Subscription {
+		c.loaders.Store(New(tracing.WithContext(ctx, e.DB), auth.ForContext(ctx)))
+	}
+	return next(ctx)
+}
+
+// For returns the operation's loaders. Outside an operation the Extension runs for, such as in plain HTTP handlers,
+// it returns loaders of their own from db, which don't batch with anything else.
+func For(ctx context.Context, db *gorm.DB) *Loaders {
+	if c, ok := ctx.Value(loadersCtxKey).(*current); ok {
+		return c.loaders.Load()
+	}
+	return New(db, auth.ForContext(ctx))
+}
+
+func New(db *gorm.DB, user *model.User) *Loaders {
+	return &Loaders{
+		users:           newLoader(fetchUsers(db)),
+		venues:          newLoader(fetchVenues(db)),
+		eventUsers:      newLoader(fetchEventUsers(db)),
+		attendingEvents: newLoader(fetchAttendingEvents(db, user)),
+		ownedEvents:     newLoader(fetchOwnedEvents(db, user)),
+		attending:       newLoader(fetchAttending(db, user)),
+	}
+}
+
+// pageKey is a comparable copy of pagination arguments, so requests for the same page can share a batch
+type pageKey struct {
+	first            int
+	after            string
+	last             int
+	before           string
+	includeCancelled bool
+}
+
+func newPageKey(args pagination.Args, includeCancelled bool) pageKey {
+	key := pageKey{includeCancelled: includeCancelled}
+	if args.First != nil {
+		key.first = *args.First
+	}
+	if args.After != nil {
+		key.after = *args.After
+	}
+	if args.Last != nil {
+		key.last = *args.Last
+	}
+	if args.Before != nil {
+		key.before = *args.Before
+	}
+	return key
+}
+
+func (key pageKey) args() pagination.Args {
+	args := pagination.Args{}
+	if key.first != 0 {
+		args.First = &key.first
+	}
+	if key.after != "" {
+		args.After = &key.after
+	}
+	if key.last != 0 {
+		args.Last = &key.last
+	}
+	if key.before != "" {
+		args.Before = &key.before
+	}
+	return args
+}
+
+type listKey struct {
+	parentID uuid.UUID
+	page     pageKey
+}
+
+// User loads a user by id
+func (l *Loaders) User(id uuid.UUID) (*model.User, error) {
+	user, err := l.users.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	return user.(*model.User), nil
+}
+
+// Venue loads a venue by id, or nil if it has been deleted
+func (l *Loaders) Venue(id uuid.UUID) (*model.Venue, error) {
+	venue, err := l.venues.Load(id)
+	if err != nil || venue == nil {
+		return nil, err
+	}
+	return venue.(*model.Venue), nil
+}
+
+// EventUsers loads one page of an event's attendees, including the extra row pagination.Page.Trim looks for
+func (l *Loaders) EventUsers(eventID uuid.UUID, args pagination.Args) ([]*model.User, error) {
+	rows, err := l.eventUsers.Load(listKey{eventID, newPageKey(args, false)})
+	if err != nil {
+		return nil, err
+	}
+	//Callers trim and reorder the page in place, so they each get their own copy of the cached rows
+	return append([]*model.User{}, rows.([]*model.User)...), nil
+}
+
+// AttendingEvents loads one page of the events a user is attending, including the extra row pagination.Page.Trim looks for
+func (l *Loaders) AttendingEvents(userID uuid.UUID, args pagination.Args, includeCancelled bool) ([]*model.Event, error) {
+	rows, err := l.attendingEvents.Load(listKey{userID, newPageKey(args, includeCancelled)})
+	if err != nil {
+		return nil, err
+	}
+	return append([]*model.Event{}, rows.([]*model.Event)...), nil
+}
+
+// OwnedEvents loads one page of the events a user owns, including the extra row pagination.Page.Trim looks for
+func (l *Loaders) OwnedEvents(userID uuid.UUID, args pagination.Args, includeCancelled bool) ([]*model.Event, error) {
+	rows, err := l.ownedEvents.Load(listKey{userID, newPageKey(args, includeCancelled)})
+	if err != nil {
+		return nil, err
+	}
+	return append([]*model.Event{}, rows.([]*model.Event)...), nil
+}
+
+// Attending reports whether the requesting user is attending an event. Anonymous users attend nothing.
+func (l *Loaders) Attending(eventID uuid.UUID) (bool, error) {
+	attending, err := l.attending.Load(eventID)
+	if err != nil {
+		return false, err
+	}
+	return attending.(bool), nil
+}
+
+func fetchUsers(db *gorm.DB) fetchFunc {
+	return func(keys []interface{}) ([]interface{}, []error) {
+		ids := make([]uuid.UUID, len(keys))
+		for i, key := range keys {
+			ids[i] = key.(uuid.UUID)
+		}
+
+		var users []*model.User
+		if err := db.Where("id IN (?)", ids).Find(&users).Error; err != nil {
+			return nil, []error{err}
+		}
+
+		byID := make(map[uuid.UUID]*model.User, len(users))
+		for _, user := range users {
+			byID[user.UUIDKey.ID] = user
+		}
+
+		data := make([]interface{}, len(keys))
+		errs := make([]error, len(keys))
+		for i, id := range ids {
+			if user, ok := byID[id]; ok {
+				data[i] = user
+			} else {
+				errs[i] = gorm.ErrRecordNotFound
+			}
+		}
+
+		return data, errs
+	}
+}
+
+func fetchVenues(db *gorm.DB) fetchFunc {
+	return func(keys []interface{}) ([]interface{}, []error) {
+		ids := make([]uuid.UUID, len(keys))
+		for i, key := range keys {
+			ids[i] = key.(uuid.UUID)
+		}
+
+		var venues []*model.Venue
+		if err := db.Where("id IN (?)", ids).Find(&venues).Error; err != nil {
+			return nil, []error{err}
+		}
+
+		byID := make(map[uuid.UUID]*model.Venue, len(venues))
+		for _, venue := range venues {
+			byID[venue.UUIDKey.ID] = venue
+		}
+
+		//Events keep pointing at venues that were deleted, which load as nil rather than failing
+		data := make([]interface{}, len(keys))
+		for i, id := range ids {
+			if venue, ok := byID[id]; ok {
+				data[i] = venue
+			}
+		}
+
+		return data, nil
+	}
+}
+
+func fetchAttending(db *gorm.DB, user *model.User) fetchFunc {
+	return func(keys []interface{}) ([]interface{}, []error) {
+		data := make([]interface{}, len(keys))
+		for i := range keys {
+			data[i] = false
+		}
+		if user == nil {
+			return data, nil
+		}
+
+		ids := make([]uuid.UUID, len(keys))
+		for i, key := range keys {
+			ids[i] = key.(uuid.UUID)
+		}
+
+		var eventIDs []uuid.UUID
+		if err := db.Table("user_events").
+			Where("user_id = ? AND event_id IN (?)", user.UUIDKey.ID, ids).
+			Pluck("event_id", &eventIDs).Error; err != nil {
+			return nil, []error{err}
+		}
+
+		attending := make(map[uuid.UUID]bool, len(eventIDs))
+		for _, id := range eventIDs {
+			attending[id] = true
+		}
+		for i, id := range ids {
+			data[i] = attending[id]
+		}
+
+		return data, nil
+	}
+}
+
+// groupByPage splits a batch of list keys by the page they ask for, since each page needs its own query
+func groupByPage(keys []interface{}) map[pageKey][]uuid.UUID {
+	groups := map[pageKey][]uuid.UUID{}
+	for _, key := range keys {
+		listKey := key.(listKey)
+		groups[listKey.page] = append(groups[listKey.page], listKey.parentID)
+	}
+	return groups
+}
+
+// rankedPage wraps a query selecting rows with a parent_id into one that keeps the first rows of the page for
+// every parent. The window function orders each parent's rows the same way pagination.Paginate would.
+func rankedPage(db *gorm.DB, query *gorm.DB, page *pagination.Page, table string, partition string) *gorm.DB {
+	query = page.Keyset(query, table).
+		Select(table + ".*, " + partition + " AS parent_id, ROW_NUMBER() OVER (PARTITION BY " + partition + " ORDER BY " + page.Order(table) + ") AS position")
+
+	return db.Raw("SELECT * FROM ? AS ranked WHERE position <= ? ORDER BY parent_id, position", query.SubQuery(), page.Fetch())
+}
+
+type userRow struct {
+	model.User
+	ParentID uuid.UUID
+	Position int
+}
+
+type eventRow struct {
+	model.Event
+	ParentID uuid.UUID
+	Position int
+}
+
+func fetchEventUsers(db *gorm.DB) fetchFunc {
+	return func(keys []interface{}) ([]interface{}, []error) {
+		byParent := map[listKey][]*model.User{}
+
+		for key, eventIDs := range groupByPage(keys) {
+			page, err := pagination.NewPage(key.args())
+			if err != nil {
+				return nil, []error{err}
+			}
+
+			query := db.Table("users").
+				Joins("JOIN user_events ON user_events.user_id = users.id").
+				Where("user_events.event_id IN (?) AND users.deleted_at IS NULL", eventIDs)
+
+			var rows []*userRow
+			if err := rankedPage(db, query, page, "users", "user_events.event_id").Scan(&rows).Error; err != nil {
+				return nil, []error{err}
+			}
+
+			for _, row := range rows {
+				user := row.User
+				byParent[listKey{row.ParentID, key}] = append(byParent[listKey{row.ParentID, key}], &user)
+			}
+		}
+
+		data := make([]interface{}, len(keys))
+		for i, key := range keys {
+			data[i] = byParent[key.(listKey)]
+		}
+
+		return data, nil
+	}
+}
+
+func fetchEvents(db *gorm.DB, user *model.User, from func(db *gorm.DB, parentIDs []uuid.UUID) *gorm.DB, partition string) fetchFunc {
+	return func(keys []interface{}) ([]interface{}, []error) {
+		byParent := map[listKey][]*model.Event{}
+
+		for key, parentIDs := range groupByPage(keys) {
+			page, err := pagination.NewPage(key.args())
+			if err != nil {
+				return nil, []error{err}
+			}
+
+			query := events.Visible(from(db.Table("events"), parentIDs), user, key.includeCancelled).
+				Where("events.deleted_at IS NULL")
+
+			var rows []*eventRow
+			if err := rankedPage(db, query, page, "events", partition).Scan(&rows).Error; err != nil {
+				return nil, []error{err}
+			}
+
+			for _, row := range rows {
+				event := row.Event
+				byParent[listKey{row.ParentID, key}] = append(byParent[listKey{row.ParentID, key}], &event)
+			}
+		}
+
+		data := make([]interface{}, len(keys))
+		for i, key := range keys {
+			data[i] = byParent[key.(listKey)]
+		}
+
+		return data, nil
+	}
+}
+
+func fetchAttendingEvents(db *gorm.DB, user *model.User) fetchFunc {
+	return fetchEvents(db, user, func(db *gorm.DB, userIDs []uuid.UUID) *gorm.DB {
+		return db.Joins("JOIN user_events ON user_events.event_id = events.id").
+			Where("user_events.user_id IN (?)", userIDs)
+	}, "user_events.user_id")
+}
+
+func fetchOwnedEvents(db *gorm.DB, user *model.User) fetchFunc {
+	return fetchEvents(db, user, func(db *gorm.DB, userIDs []uuid.UUID) *gorm.DB {
+		return db.Where("events.owner_id IN (?)", userIDs)
+	}, "events.owner_id")
+}
@@ -0,0 +1,336 @@
+package loaders
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	uuid "github.com/satori/go.uuid"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// createTable creates a table with the model's columns. SQLite has no arrays, so those are stored as text.
+func createTable(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	scope := db.NewScope(value)
+	var columns []string
+	for _, field := range scope.Fields() {
+		if field.IsNormal && !field.IsIgnored {
+			dataType := scope.Dialect().DataTypeOf(field.StructField)
+			if strings.HasSuffix(dataType, "[]") {
+				dataType = "text"
+			}
+			columns = append(columns, field.DBName+" "+dataType)
+		}
+	}
+	if err := db.Exec("CREATE TABLE " + scope.TableName() + " (" + strings.Join(columns, ", ") + ")").Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queryCounter counts the queries GORM runs against a database
+type queryCounter struct {
+	n int64
+}
+
+func (c *queryCounter) count(scope *gorm.Scope) {
+	atomic.AddInt64(&c.n, 1)
+}
+
+func (c *queryCounter) reset() {
+	atomic.StoreInt64(&c.n, 0)
+}
+
+func (c *queryCounter) get() int {
+	return int(atomic.LoadInt64(&c.n))
+}
+
+func open(t *testing.T) (*gorm.DB, *queryCounter) {
+	t.Helper()
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	t.Cleanup(func() { db.Close() })
+	//Every connection to :memory: gets its own empty database
+	db.DB().SetMaxOpenConns(1)
+
+	createTable(t, db, &model.User{})
+	createTable(t, db, &model.Event{})
+	if err := db.Exec("CREATE TABLE user_events (user_id, event_id)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &queryCounter{}
+	db.Callback().Query().After("gorm:query").Register("test:count_queries", counter.count)
+	db.Callback().RowQuery().After("gorm:row_query").Register("test:count_row_queries", counter.count)
+	return db, counter
+}
+
+// newLoaders gives loads more time to join a batch than the resolvers need, so slow test machines don't split them
+func newLoaders(db *gorm.DB, user *model.User) *Loaders {
+	l := New(db, user)
+	for _, loader := range []*Loader{l.users, l.venues, l.eventUsers, l.attendingEvents, l.ownedEvents, l.attending} {
+		loader.wait = 50 * time.Millisecond
+	}
+	return l
+}
+
+func createUser(t *testing.T, db *gorm.DB, name string) *model.User {
+	t.Helper()
+	user := &model.User{FirstName: name, Username: name}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createEvent(t *testing.T, db *gorm.DB, owner *model.User, attendees ...*model.User) *model.Event {
+	t.Helper()
+	event := &model.Event{Name: "event", OwnerID: owner.UUIDKey.ID, Status: model.EventStatusPublished}
+	if err := db.Create(event).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, attendee := range attendees {
+		if err := db.Exec("INSERT INTO user_events (user_id, event_id) VALUES (?, ?)", attendee.UUIDKey.ID, event.UUIDKey.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return event
+}
+
+// loadNested loads every event's owner and first page of attendees at once, the way resolving
+// events { owner attendees } does
+func loadNested(t *testing.T, l *Loaders, events []*model.Event) ([]*model.User, [][]*model.User) {
+	t.Helper()
+
+	owners := make([]*model.User, len(events))
+	attendees := make([][]*model.User, len(events))
+	errs := make(chan error, 2*len(events))
+	var wg sync.WaitGroup
+	for i, event := range events {
+		wg.Add(2)
+		go func(i int, event *model.Event) {
+			defer wg.Done()
+			owner, err := l.User(event.OwnerID)
+			owners[i] = owner
+			errs <- err
+		}(i, event)
+		go func(i int, event *model.Event) {
+			defer wg.Done()
+			users, err := l.EventUsers(event.UUIDKey.ID, pagination.Args{})
+			attendees[i] = users
+			errs <- err
+		}(i, event)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return owners, attendees
+}
+
+func TestNestedListsBatch(t *testing.T) {
+	db, counter := open(t)
+
+	var owners []*model.User
+	var events []*model.Event
+	for i := 0; i < 3; i++ {
+		owner := createUser(t, db, "owner")
+		owners = append(owners, owner)
+		for j := 0; j < 5; j++ {
+			events = append(events, createEvent(t, db, owner, createUser(t, db, "first"), createUser(t, db, "second")))
+		}
+	}
+
+	counter.reset()
+	l := newLoaders(db, nil)
+	loadedOwners, attendees := loadNested(t, l, events)
+
+	//One query for the owners and one for the attendees, however many events there are
+	if queries := counter.get(); queries != 2 {
+		t.Errorf("loading owners and attendees of %d events ran %d queries, want 2", len(events), queries)
+	}
+	for i, event := range events {
+		if loadedOwners[i].UUIDKey.ID != event.OwnerID {
+			t.Errorf("event %d has owner %s, want %s", i, loadedOwners[i].UUIDKey.ID, event.OwnerID)
+		}
+		if len(attendees[i]) != 2 {
+			t.Errorf("event %d has %d attendees, want 2", i, len(attendees[i]))
+		}
+	}
+
+	counter.reset()
+	loadNested(t, l, events)
+	if queries := counter.get(); queries != 0 {
+		t.Errorf("loading the same owners and attendees again ran %d queries, want 0", queries)
+	}
+}
+
+func TestEventListsBatchPerPage(t *testing.T) {
+	db, counter := open(t)
+
+	var users []*model.User
+	for i := 0; i < 4; i++ {
+		user := createUser(t, db, "owner")
+		users = append(users, user)
+		for j := 0; j < 3; j++ {
+			createEvent(t, db, user)
+		}
+	}
+
+	counter.reset()
+	l := newLoaders(db, nil)
+	first, two := 2, 2
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(2)
+		go func(user *model.User) {
+			defer wg.Done()
+			owned, err := l.OwnedEvents(user.UUIDKey.ID, pagination.Args{}, false)
+			if err != nil {
+				t.Error(err)
+			} else if len(owned) != 3 {
+				t.Errorf("user owns %d events, want 3", len(owned))
+			}
+		}(user)
+		go func(user *model.User) {
+			defer wg.Done()
+			owned, err := l.OwnedEvents(user.UUIDKey.ID, pagination.Args{First: &first}, false)
+			if err != nil {
+				t.Error(err)
+			} else if len(owned) != first+1 {
+				t.Errorf("first page has %d events, want %d with the extra row", len(owned), first+1)
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	//Each distinct page is one query across all users
+	if queries := counter.get(); queries != 2 {
+		t.Errorf("loading two pages of owned events for %d users ran %d queries, want 2", len(users), queries)
+	}
+
+	counter.reset()
+	if _, err := l.OwnedEvents(users[0].UUIDKey.ID, pagination.Args{First: &two}, false); err != nil {
+		t.Fatal(err)
+	}
+	if queries := counter.get(); queries != 0 {
+		t.Errorf("an equal page ran %d queries, want 0 from the cache", queries)
+	}
+}
+
+func TestAttendingBatches(t *testing.T) {
+	db, counter := open(t)
+
+	owner := createUser(t, db, "owner")
+	attendee := createUser(t, db, "attendee")
+	attended := createEvent(t, db, owner, attendee)
+	skipped := createEvent(t, db, owner)
+
+	counter.reset()
+	l := newLoaders(db, attendee)
+	results := make(map[uuid.UUID]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, event := range []*model.Event{attended, skipped} {
+		wg.Add(1)
+		go func(event *model.Event) {
+			defer wg.Done()
+			attending, err := l.Attending(event.UUIDKey.ID)
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			results[event.UUIDKey.ID] = attending
+			mu.Unlock()
+		}(event)
+	}
+	wg.Wait()
+
+	if queries := counter.get(); queries != 1 {
+		t.Errorf("checking attendance of 2 events ran %d queries, want 1", queries)
+	}
+	if !results[attended.UUIDKey.ID] || results[skipped.UUIDKey.ID] {
+		t.Errorf("attendance is %v, want only %s", results, attended.UUIDKey.ID)
+	}
+
+	counter.reset()
+	if attending, err := New(db, nil).Attending(attended.UUIDKey.ID); err != nil || attending {
+		t.Errorf("anonymous attendance is %v, %v, want false", attending, err)
+	}
+	if queries := counter.get(); queries != 0 {
+		t.Errorf("anonymous attendance ran %d queries, want 0", queries)
+	}
+}
+
+func operation(operationType ast.Operation) context.Context {
+	return graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		Operation: &ast.OperationDefinition{Operation: operationType},
+	})
+}
+
+func TestExtensionScopesLoadersToOperations(t *testing.T) {
+	db, _ := open(t)
+	extension := Extension{DB: db}
+
+	//A websocket connection runs each of its operations with the same connection context
+	var loaders []*Loaders
+	for i := 0; i < 2; i++ {
+		extension.InterceptOperation(operation(ast.Query), func(ctx context.Context) graphql.ResponseHandler {
+			loaders = append(loaders, For(ctx, db))
+			return nil
+		})
+	}
+	if loaders[0] == loaders[1] {
+		t.Error("two operations shared their loaders")
+	}
+
+	//Subscription resolvers keep the operation's context, but get fresh loaders for every event
+	var subscriptionCtx context.Context
+	responses := extension.InterceptOperation(operation(ast.Subscription), func(ctx context.Context) graphql.ResponseHandler {
+		subscriptionCtx = ctx
+		return func(ctx context.Context) *graphql.Response {
+			return &graphql.Response{}
+		}
+	})
+
+	var sent []*Loaders
+	for i := 0; i < 2; i++ {
+		extension.InterceptResponse(subscriptionCtx, func(ctx context.Context) *graphql.Response {
+			sent = append(sent, For(subscriptionCtx, db))
+			return responses(ctx)
+		})
+	}
+	if sent[0] == sent[1] {
+		t.Error("two subscription events shared their loaders")
+	}
+}
+
+func TestForWithoutExtension(t *testing.T) {
+	db, _ := open(t)
+	owner := createUser(t, db, "owner")
+
+	//Plain HTTP handlers don't run the extension, so they get loaders of their own instead of a panic
+	user, err := For(context.Background(), db).User(owner.UUIDKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UUIDKey.ID != owner.UUIDKey.ID {
+		t.Errorf("loaded user %s, want %s", user.UUIDKey.ID, owner.UUIDKey.ID)
+	}
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/opaquee/EventMapAPI/helpers/operation"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const redacted = "[REDACTED]"
+
+// Variables with any of these in their name are never logged
+var secretNames = []string{"password", "token", "secret", "authorization", "apikey", "api_key", "accesskey", "access_key"}
+
+// AccessLog is a gqlgen extension that logs one line per operation with its name, duration and error count, and
+// every error with its path, so errors returned to clients are also on record. Subscriptions are logged when they
+// start and when they send an error.
+type AccessLog struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = AccessLog{}
+
+func (AccessLog) ExtensionName() string {
+	return "AccessLog"
+}
+
+func (AccessLog) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (AccessLog) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	rc := graphql.GetOperationContext(ctx)
+	if name, operationType := operation.Labels(rc); operationType == string(ast.Subscription) {
+		For(ctx).Info("graphql subscription started",
+			"operation", name,
+			"variables", Redact(rc.Variables),
+		)
+	}
+	return next(ctx)
+}
+
+func (AccessLog) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	response := next(ctx)
+	if response == nil || !graphql.HasOperationContext(ctx) {
+		return response
+	}
+
+	rc := graphql.GetOperationContext(ctx)
+	name, operationType := operation.Labels(rc)
+	logger := For(ctx)
+
+	for _, err := range response.Errors {
+		logger.Warn("graphql error",
+			"operation", name,
+			"path", err.Path,
+			"error", err.Message,
+		)
+	}
+
+	if operationType != string(ast.Subscription) {
+		logger.Info("graphql operation",
+			"operation", name,
+			"type", operationType,
+			"duration_ms", time.Since(rc.Stats.OperationStart).Milliseconds(),
+			"errors", len(response.Errors),
+			"variables", Redact(rc.Variables),
+		)
+	}
+
+	return response
+}
+
+// Redact copies variables with the values of secret-looking fields replaced, however deeply they're nested
+func Redact(variables map[string]interface{}) slog.Value {
+	return slog.AnyValue(redactValue(variables))
+}
+
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			if isSecret(key) {
+				copied[key] = redacted
+			} else {
+				copied[key] = redactValue(field)
+			}
+		}
+		return copied
+	case graphql.Upload:
+		return "upload " + value.Filename
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = redactValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
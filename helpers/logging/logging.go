@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var loggerCtxKey = &contextKey{"logger"}
+var requestIDCtxKey = &contextKey{"requestID"}
+
+type contextKey struct {
+	name string
+}
+
+// Incoming request IDs are kept only if they can't be used to forge log lines or blow up their size
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Setup makes the default logger write JSON in production and readable text everywhere else. The standard log
+// package writes through it too, so every line ends up in the same format.
+func Setup(environment string, level string) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		logLevel = slog.LevelInfo
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if environment == "production" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	log.SetFlags(0)
+}
+
+// For returns the logger for a request, which adds its request ID and principal to every line
+func For(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerCtxKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func with(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey, logger)
+}
+
+// RequestID tags a request with the ID the client or proxy sent in X-Request-ID, or a new one, and echoes it back so
+// a client can quote it when reporting a problem. It runs after tracing so lines can be matched to their trace.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewV4().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDCtxKey, requestID)
+		r = r.WithContext(with(ctx, logger))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestIDFor returns the ID RequestID gave a request, or an empty string outside of one
+func RequestIDFor(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDCtxKey).(string)
+	return requestID
+}
+
+// Principal adds the authenticated user to the request's logger. It has to run after the auth middleware.
+func Principal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := auth.ForContext(r.Context()); user != nil {
+			r = r.WithContext(with(r.Context(), For(r.Context()).With("user_id", user.UUIDKey.ID.String())))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const startKey = "metrics:start"
+
+// RegisterCallbacks times every create, query, update, delete and row query made through db
+func RegisterCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+
+	callbacks.Create().Before("gorm:begin_transaction").Register("metrics:before_create", start)
+	callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("metrics:after_create", observe("create"))
+	callbacks.Query().Before("gorm:query").Register("metrics:before_query", start)
+	callbacks.Query().After("gorm:after_query").Register("metrics:after_query", observe("query"))
+	callbacks.Update().Before("gorm:begin_transaction").Register("metrics:before_update", start)
+	callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("metrics:after_update", observe("update"))
+	callbacks.Delete().Before("gorm:begin_transaction").Register("metrics:before_delete", start)
+	callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("metrics:after_delete", observe("delete"))
+	callbacks.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", start)
+	callbacks.RowQuery().After("gorm:row_query").Register("metrics:after_row_query", observe("row_query"))
+}
+
+func start(scope *gorm.Scope) {
+	scope.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		started, ok := scope.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+
+		table := scope.TableName()
+		if table == "" {
+			table = "unknown"
+		}
+
+		QueryDuration.WithLabelValues(operation, table).Observe(time.Since(started.(time.Time)).Seconds())
+		if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+			QueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
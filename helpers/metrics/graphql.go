@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/opaquee/EventMapAPI/helpers/operation"
+	"github.com/opaquee/EventMapAPI/helpers/persisted"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Tracer is a gqlgen extension recording operation and resolver timings. Subscriptions only count errors, since
+// their responses arrive whenever events do.
+type Tracer struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = Tracer{}
+
+func (Tracer) ExtensionName() string {
+	return "Metrics"
+}
+
+func (Tracer) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Tracer) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	response := next(ctx)
+	if !graphql.HasOperationContext(ctx) {
+		return response
+	}
+
+	rc := graphql.GetOperationContext(ctx)
+	name, operationType := operation.Labels(rc)
+	//Clients pick operation names, so only registered ones become labels. Others are labelled by their root fields.
+	if !persisted.Registered(name) {
+		name = operation.RootFields(rc)
+	}
+
+	if operationType != string(ast.Subscription) {
+		OperationDuration.WithLabelValues(name, operationType).Observe(time.Since(rc.Stats.OperationStart).Seconds())
+	}
+	if response != nil && len(response.Errors) > 0 {
+		OperationErrors.WithLabelValues(name, operationType).Inc()
+	}
+
+	return response
+}
+
+// InterceptField only times fields backed by a method, since plain struct fields cost next to nothing
+func (Tracer) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsMethod {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+
+	FieldDuration.WithLabelValues(fc.Object, fc.Field.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		FieldErrors.WithLabelValues(fc.Object, fc.Field.Name).Inc()
+	}
+
+	return res, err
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "eventmap"
+
+var (
+	OperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_operation_duration_seconds",
+		Help:      "Time taken to execute GraphQL queries and mutations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "type"})
+
+	OperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_operation_errors_total",
+		Help:      "GraphQL responses that carried at least one error.",
+	}, []string{"operation", "type"})
+
+	FieldDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_field_duration_seconds",
+		Help:      "Time taken by field resolvers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"object", "field"})
+
+	FieldErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_field_errors_total",
+		Help:      "Field resolvers that returned an error.",
+	}, []string{"object", "field"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries made through GORM.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	QueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database queries that failed, not counting ones that found no records.",
+	}, []string{"operation", "table"})
+
+	GeocoderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "geocoder_request_duration_seconds",
+		Help:      "Time taken by requests to the geocoding API.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	GeocoderFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_failures_total",
+		Help:      "Geocoding lookups that failed, by reason.",
+	}, []string{"reason"})
+
+	GeocoderCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "geocoder_cache_lookups_total",
+		Help:      "Geocoding lookups answered from the cache or sent to the geocoding API, by result.",
+	}, []string{"result"})
+
+	ActiveSubscriptions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_subscriptions",
+		Help:      "Open newEvents subscriptions per zip code.",
+	}, []string{"zip"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+)
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,310 @@
+package migrate
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Dir is where migration files live in the source tree. They're compiled into the binary, so a deployed server
+// doesn't need them on disk.
+const Dir = "helpers/migrate/migrations"
+
+// lockKey serializes migrations between servers sharing a database
+const lockKey = 72150436
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Applied is a row of the schema version table, one per migration that has run
+type Applied struct {
+	Version   int `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (Applied) TableName() string {
+	return "schema_migrations"
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// All returns the embedded migrations ordered by version
+func All() ([]Migration, error) {
+	entries, err := files.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.New("migration file name " + entry.Name() + " isn't VERSION_name.up.sql or VERSION_name.down.sql")
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := files.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	all := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", migration.Version)
+		}
+		all = append(all, *migration)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+
+	return all, nil
+}
+
+func createTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL
+	)`).Error
+}
+
+func applied(db *gorm.DB) (map[int]time.Time, error) {
+	var exists bool
+	row := db.Raw("SELECT to_regclass('schema_migrations') IS NOT NULL").Row()
+	if err := row.Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]time.Time{}
+	if !exists {
+		return byVersion, nil
+	}
+
+	var rows []Applied
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byVersion[row.Version] = row.AppliedAt
+	}
+	return byVersion, nil
+}
+
+// run applies one direction of a migration in its own transaction, together with the change to the version table.
+// The advisory lock makes a second server wait, and the recheck makes it skip work the first one already did.
+func run(db *gorm.DB, migration Migration, up bool) (bool, error) {
+	ran := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockKey).Error; err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.Model(&Applied{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+
+		if up {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&Applied{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		}
+
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return err
+		}
+		ran = true
+		return tx.Where("version = ?", migration.Version).Delete(&Applied{}).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+	}
+
+	return ran, nil
+}
+
+// Up applies every pending migration in order and returns the ones it ran
+func Up(db *gorm.DB) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if err := createTable(db); err != nil {
+		return nil, err
+	}
+
+	ran := []Migration{}
+	for _, migration := range all {
+		ok, err := run(db, migration, true)
+		if err != nil {
+			return ran, err
+		}
+		if ok {
+			ran = append(ran, migration)
+		}
+	}
+
+	return ran, nil
+}
+
+// Down rolls back the given number of the most recently applied migrations and returns the ones it reverted
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []Migration{}
+	for i := len(all) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if _, ok := done[all[i].Version]; !ok {
+			continue
+		}
+
+		ok, err := run(db, all[i], false)
+		if err != nil {
+			return reverted, err
+		}
+		if ok {
+			reverted = append(reverted, all[i])
+		}
+	}
+
+	return reverted, nil
+}
+
+// Statuses lists every migration along with when it was applied, if it has been
+func Statuses(db *gorm.DB) ([]Status, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(all))
+	for i, migration := range all {
+		statuses[i] = Status{Migration: migration}
+		if appliedAt, ok := done[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+// Check fails if any migration compiled into the binary hasn't been applied, so the server never runs against a
+// schema older than its code expects
+func Check(db *gorm.DB) error {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return err
+	}
+
+	pending := []string{}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, strconv.Itoa(status.Version)+"_"+status.Name)
+		}
+	}
+	if len(pending) > 0 {
+		return errors.New("database schema is missing migrations " + strings.Join(pending, ", ") + ", run the migrate up command first")
+	}
+
+	return nil
+}
+
+// Create writes empty up and down files for a new migration numbered after the newest one in dir
+func Create(dir string, name string) ([]string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name can't be empty")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	version := 0
+	for _, entry := range entries {
+		if match := fileName.FindStringSubmatch(entry.Name()); match != nil {
+			if existing, _ := strconv.Atoi(match[1]); existing > version {
+				version = existing
+			}
+		}
+	}
+
+	created := []string{}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", version+1, name, direction))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return created, err
+		}
+		_, err = file.WriteString("-- " + direction + " migration for " + name + "\n")
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return created, err
+		}
+		created = append(created, path)
+	}
+
+	return created, nil
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS rate_limit_buckets;
+DROP TABLE IF EXISTS persisted_queries;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS user_events;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
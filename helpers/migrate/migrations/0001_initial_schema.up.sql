@@ -0,0 +1,97 @@
+-- Matches the tables AutoMigrate used to create, so databases set up before migrations existed can adopt this one
+CREATE TABLE IF NOT EXISTS users (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	first_name text,
+	last_name text,
+	email text,
+	username text,
+	password text,
+	profile_picture_path text,
+	is_staff boolean
+);
+-- Databases AutoMigrated before these columns existed already have the tables, so the columns are added separately
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_staff boolean;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	name text,
+	slug text
+);
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_categories_slug ON categories (slug);
+
+CREATE TABLE IF NOT EXISTS events (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	name text,
+	description text,
+	address_line1 text,
+	address_line2 text,
+	city text,
+	state text,
+	zip integer,
+	latitude numeric,
+	longitude numeric,
+	start_date timestamp with time zone,
+	end_date timestamp with time zone,
+	owner_id uuid,
+	status text DEFAULT 'PUBLISHED',
+	cancellation_reason text,
+	category_id uuid,
+	tags text[]
+);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS status text DEFAULT 'PUBLISHED';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS cancellation_reason text;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS category_id uuid;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS tags text[];
+CREATE INDEX IF NOT EXISTS idx_events_deleted_at ON events (deleted_at);
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'events_owner_id_users_id_foreign') THEN
+		ALTER TABLE events ADD CONSTRAINT events_owner_id_users_id_foreign
+			FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE;
+	END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS user_events (
+	user_id uuid,
+	event_id uuid,
+	PRIMARY KEY (user_id, event_id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id uuid,
+	event_id uuid,
+	status text,
+	message text,
+	read boolean
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_deleted_at ON notifications (deleted_at);
+
+CREATE TABLE IF NOT EXISTS persisted_queries (
+	hash text PRIMARY KEY,
+	document text,
+	created_at timestamp with time zone
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+	key text PRIMARY KEY,
+	tokens numeric,
+	allowed boolean,
+	updated_at timestamp with time zone
+);
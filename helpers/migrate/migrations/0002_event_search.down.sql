@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_events_name_trgm;
+DROP INDEX IF EXISTS idx_events_search_vector;
+DROP TRIGGER IF EXISTS events_search_vector_trigger ON events;
+DROP FUNCTION IF EXISTS events_search_vector_update();
+ALTER TABLE events DROP COLUMN IF EXISTS search_vector;
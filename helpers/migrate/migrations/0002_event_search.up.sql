@@ -0,0 +1,25 @@
+-- The search vector is kept up to date by a trigger instead of the model, so saving an event through GORM can't go stale
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION events_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.city, '')), 'C') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS events_search_vector_trigger ON events;
+CREATE TRIGGER events_search_vector_trigger BEFORE INSERT OR UPDATE ON events
+	FOR EACH ROW EXECUTE PROCEDURE events_search_vector_update();
+
+CREATE INDEX IF NOT EXISTS idx_events_search_vector ON events USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_events_name_trgm ON events USING gin (name gin_trgm_ops);
+
+-- Touching rows that predate the trigger fills in their search vector
+UPDATE events SET name = name WHERE search_vector IS NULL;
@@ -0,0 +1,23 @@
+-- The old columns were kept in sync, so they already hold every event's address
+DROP TRIGGER events_address_sync ON events;
+DROP FUNCTION events_address_sync();
+
+CREATE OR REPLACE FUNCTION events_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.city, '')), 'C') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP INDEX idx_events_postal_code;
+
+ALTER TABLE events
+	DROP COLUMN address_country_code,
+	DROP COLUMN address_postal_code,
+	DROP COLUMN address_region,
+	DROP COLUMN address_locality,
+	DROP COLUMN address_lines;
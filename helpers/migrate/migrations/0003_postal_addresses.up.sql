@@ -0,0 +1,57 @@
+-- Events store a postal address that works in any country instead of US-only address columns
+ALTER TABLE events
+	ADD COLUMN address_country_code text,
+	ADD COLUMN address_postal_code text,
+	ADD COLUMN address_region text,
+	ADD COLUMN address_locality text,
+	ADD COLUMN address_lines text[];
+
+CREATE OR REPLACE FUNCTION events_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(NEW.address_locality, '')), 'C') ||
+		setweight(to_tsvector('english', coalesce(NEW.description, '')), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- Zips were stored as integers, which dropped their leading zeros
+UPDATE events SET
+	address_country_code = 'US',
+	address_postal_code = CASE WHEN zip BETWEEN 0 AND 99999 THEN lpad(zip::text, 5, '0') ELSE '' END,
+	address_region = upper(trim(coalesce(state, ''))),
+	address_locality = trim(coalesce(city, '')),
+	address_lines = array_remove(ARRAY[trim(coalesce(address_line1, '')), trim(coalesce(address_line2, ''))], '');
+
+-- Servers from before this migration keep writing the old columns until a rolling deploy replaces them, so both sets of
+-- columns are kept in sync from whichever one a write changed. A later release drops the old columns.
+CREATE OR REPLACE FUNCTION events_address_sync() RETURNS trigger AS $$
+BEGIN
+	IF (TG_OP = 'INSERT' AND NEW.address_country_code IS NOT NULL) OR (TG_OP = 'UPDATE' AND
+		(NEW.address_country_code, NEW.address_postal_code, NEW.address_region, NEW.address_locality, NEW.address_lines) IS DISTINCT FROM
+		(OLD.address_country_code, OLD.address_postal_code, OLD.address_region, OLD.address_locality, OLD.address_lines)) THEN
+		NEW.address_line1 := coalesce(NEW.address_lines[1], '');
+		NEW.address_line2 := coalesce(NEW.address_lines[2], '');
+		NEW.city := NEW.address_locality;
+		NEW.state := NEW.address_region;
+		NEW.zip := CASE WHEN NEW.address_country_code = 'US' AND NEW.address_postal_code ~ '^[0-9]{5}' THEN left(NEW.address_postal_code, 5)::integer END;
+	ELSIF TG_OP = 'INSERT' OR
+		(NEW.address_line1, NEW.address_line2, NEW.city, NEW.state, NEW.zip) IS DISTINCT FROM
+		(OLD.address_line1, OLD.address_line2, OLD.city, OLD.state, OLD.zip) THEN
+		NEW.address_country_code := 'US';
+		NEW.address_postal_code := CASE WHEN NEW.zip BETWEEN 0 AND 99999 THEN lpad(NEW.zip::text, 5, '0') ELSE '' END;
+		NEW.address_region := upper(trim(coalesce(NEW.state, '')));
+		NEW.address_locality := trim(coalesce(NEW.city, ''));
+		NEW.address_lines := array_remove(ARRAY[trim(coalesce(NEW.address_line1, '')), trim(coalesce(NEW.address_line2, ''))], '');
+	END IF;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- Triggers fire in name order, so this one runs before the search vector reads the locality
+CREATE TRIGGER events_address_sync BEFORE INSERT OR UPDATE ON events
+	FOR EACH ROW EXECUTE PROCEDURE events_address_sync();
+
+CREATE INDEX idx_events_postal_code ON events (address_country_code, address_postal_code);
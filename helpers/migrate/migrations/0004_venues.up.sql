@@ -0,0 +1,24 @@
+CREATE TABLE venues (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	name text,
+	address_country_code text,
+	address_postal_code text,
+	address_region text,
+	address_locality text,
+	address_lines text[],
+	latitude numeric,
+	longitude numeric,
+	capacity integer,
+	accessibility_notes text,
+	owner_id uuid REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX idx_venues_deleted_at ON venues (deleted_at);
+CREATE INDEX idx_venues_owner_id ON venues (owner_id);
+CREATE INDEX idx_venues_location ON venues (latitude, longitude);
+
+-- Events keep the address they copied from a venue if the venue is ever removed
+ALTER TABLE events ADD COLUMN venue_id uuid REFERENCES venues (id) ON DELETE SET NULL ON UPDATE CASCADE;
+CREATE INDEX idx_events_venue_id ON events (venue_id);
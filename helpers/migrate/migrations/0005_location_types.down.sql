@@ -0,0 +1,3 @@
+ALTER TABLE events
+	DROP COLUMN location_type,
+	DROP COLUMN join_url;
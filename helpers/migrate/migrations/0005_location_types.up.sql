@@ -0,0 +1,4 @@
+-- Every event so far was held in person
+ALTER TABLE events
+	ADD COLUMN location_type text NOT NULL DEFAULT 'IN_PERSON',
+	ADD COLUMN join_url text NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS events_location_update ON events;
+DROP FUNCTION IF EXISTS events_location_update();
+ALTER TABLE events DROP COLUMN IF EXISTS location;
+
+DROP TRIGGER events_geohash_update ON events;
+DROP FUNCTION events_geohash_update();
+ALTER TABLE events DROP COLUMN geohash;
+DROP FUNCTION geohash_encode(double precision, double precision, integer);
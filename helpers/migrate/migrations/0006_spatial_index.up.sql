@@ -0,0 +1,97 @@
+-- Geohashes index event locations on any Postgres. Base32 characters each halve longitude and latitude in turn,
+-- so nearby events share prefixes that a btree can range scan.
+CREATE FUNCTION geohash_encode(latitude double precision, longitude double precision, precision integer) RETURNS text AS $$
+DECLARE
+	alphabet CONSTANT text := '0123456789bcdefghjkmnpqrstuvwxyz';
+	lat_min double precision := -90;
+	lat_max double precision := 90;
+	lng_min double precision := -180;
+	lng_max double precision := 180;
+	mid double precision;
+	hash text := '';
+	bits integer := 0;
+	code integer := 0;
+	even boolean := true;
+BEGIN
+	WHILE length(hash) < precision LOOP
+		IF even THEN
+			mid := (lng_min + lng_max) / 2;
+			IF longitude >= mid THEN
+				code := code * 2 + 1;
+				lng_min := mid;
+			ELSE
+				code := code * 2;
+				lng_max := mid;
+			END IF;
+		ELSE
+			mid := (lat_min + lat_max) / 2;
+			IF latitude >= mid THEN
+				code := code * 2 + 1;
+				lat_min := mid;
+			ELSE
+				code := code * 2;
+				lat_max := mid;
+			END IF;
+		END IF;
+		even := NOT even;
+		bits := bits + 1;
+		IF bits = 5 THEN
+			hash := hash || substr(alphabet, code + 1, 1);
+			bits := 0;
+			code := 0;
+		END IF;
+	END LOOP;
+	RETURN hash;
+END
+$$ LANGUAGE plpgsql IMMUTABLE STRICT;
+
+ALTER TABLE events ADD COLUMN geohash text;
+
+-- Online events have no place on the map, so they're left out of the spatial columns
+CREATE FUNCTION events_geohash_update() RETURNS trigger AS $$
+BEGIN
+	NEW.geohash := CASE WHEN NEW.location_type = 'ONLINE' THEN NULL ELSE geohash_encode(NEW.latitude, NEW.longitude, 9) END;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER events_geohash_update BEFORE INSERT OR UPDATE OF latitude, longitude, location_type ON events
+	FOR EACH ROW EXECUTE PROCEDURE events_geohash_update();
+
+UPDATE events SET geohash = CASE WHEN location_type = 'ONLINE' THEN NULL ELSE geohash_encode(latitude, longitude, 9) END;
+
+CREATE INDEX idx_events_geohash ON events (geohash text_pattern_ops);
+
+-- A geography column with a GiST index is added too when the server has PostGIS and we're allowed to install it.
+-- The server checks for the column at startup and uses it when it's there.
+DO $do$
+BEGIN
+	IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+		BEGIN
+			CREATE EXTENSION IF NOT EXISTS postgis;
+
+			ALTER TABLE events ADD COLUMN location geography(Point, 4326);
+
+			CREATE FUNCTION events_location_update() RETURNS trigger AS $$
+			BEGIN
+				NEW.location := CASE WHEN NEW.location_type = 'ONLINE' THEN NULL
+					ELSE ST_SetSRID(ST_MakePoint(NEW.longitude, NEW.latitude), 4326)::geography END;
+				RETURN NEW;
+			END
+			$$ LANGUAGE plpgsql;
+
+			CREATE TRIGGER events_location_update BEFORE INSERT OR UPDATE OF latitude, longitude, location_type ON events
+				FOR EACH ROW EXECUTE PROCEDURE events_location_update();
+
+			UPDATE events SET location = ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography
+				WHERE location_type <> 'ONLINE';
+
+			-- Distances are measured on the geography, viewports are boxes of longitude and latitude
+			CREATE INDEX idx_events_location ON events USING GIST (location);
+			CREATE INDEX idx_events_location_box ON events USING GIST ((location::geometry));
+		EXCEPTION WHEN insufficient_privilege THEN
+			RAISE NOTICE 'PostGIS is available but couldn''t be installed, event locations are only indexed by geohash';
+		END;
+	END IF;
+END
+$do$;
@@ -0,0 +1,13 @@
+CREATE TABLE calendar_feeds (
+	id uuid PRIMARY KEY,
+	created_at timestamp with time zone,
+	updated_at timestamp with time zone,
+	deleted_at timestamp with time zone,
+	user_id uuid REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	name text,
+	token_hash text NOT NULL,
+	last_used_at timestamp with time zone
+);
+CREATE INDEX idx_calendar_feeds_deleted_at ON calendar_feeds (deleted_at);
+CREATE INDEX idx_calendar_feeds_user_id ON calendar_feeds (user_id);
+CREATE UNIQUE INDEX idx_calendar_feeds_token_hash ON calendar_feeds (token_hash);
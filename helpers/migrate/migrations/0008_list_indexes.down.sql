@@ -0,0 +1,3 @@
+DROP INDEX idx_notifications_user_id;
+DROP INDEX idx_user_events_event_id;
+DROP INDEX idx_events_owner_id;
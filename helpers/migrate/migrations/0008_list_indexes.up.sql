@@ -0,0 +1,3 @@
+CREATE INDEX idx_events_owner_id ON events (owner_id, created_at, id);
+CREATE INDEX idx_user_events_event_id ON user_events (event_id, user_id);
+CREATE INDEX idx_notifications_user_id ON notifications (user_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX idx_persisted_queries_last_used_at;
+ALTER TABLE persisted_queries DROP COLUMN last_used_at;
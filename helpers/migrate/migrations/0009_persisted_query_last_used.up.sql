@@ -0,0 +1,3 @@
+ALTER TABLE persisted_queries ADD COLUMN last_used_at timestamp with time zone;
+UPDATE persisted_queries SET last_used_at = created_at;
+CREATE INDEX idx_persisted_queries_last_used_at ON persisted_queries (last_used_at);
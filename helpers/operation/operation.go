@@ -0,0 +1,68 @@
+package operation
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Labels names an operation and its type the same way in logs, metrics and traces. Operations without a name are
+// "anonymous", and ones that didn't parse have the type "unknown".
+func Labels(rc *graphql.OperationContext) (string, string) {
+	name := rc.OperationName
+	operationType := "unknown"
+
+	if rc.Doc != nil {
+		if op := rc.Doc.Operations.ForName(rc.OperationName); op != nil {
+			operationType = string(op.Operation)
+			if name == "" {
+				name = op.Name
+			}
+		}
+	}
+	if name == "" {
+		name = "anonymous"
+	}
+
+	return name, operationType
+}
+
+// RootFields names an operation by the root fields it selects, sorted and joined with "+". Unlike operation names,
+// which clients pick, these only come from the schema. Operations that didn't parse are "unknown".
+func RootFields(rc *graphql.OperationContext) string {
+	if rc.Doc == nil {
+		return "unknown"
+	}
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return "unknown"
+	}
+
+	seen := map[string]bool{}
+	collectFields(op.SelectionSet, seen)
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return strings.Join(fields, "+")
+}
+
+// collectFields adds the names of the fields in a selection set to seen, looking inside fragments at the same level
+func collectFields(selectionSet ast.SelectionSet, seen map[string]bool) {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			seen[selection.Name] = true
+		case *ast.InlineFragment:
+			collectFields(selection.SelectionSet, seen)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				collectFields(selection.Definition.SelectionSet, seen)
+			}
+		}
+	}
+}
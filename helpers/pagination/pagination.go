@@ -0,0 +1,170 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	uuid "github.com/satori/go.uuid"
+)
+
+const DefaultPageSize = 20
+
+var maxPageSize = 100
+
+func Configure(cfg config.Pagination) {
+	maxPageSize = cfg.MaxPageSize
+}
+
+// MaxPageSize is the most rows a single page can hold
+func MaxPageSize() int {
+	return maxPageSize
+}
+
+type Args struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+}
+
+// Cursors point at a row by its creation time and id, which together give every table a stable order
+func Cursor(key model.UUIDKey) string {
+	return base64.StdEncoding.EncodeToString([]byte(key.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + key.ID.String()))
+}
+
+type key struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+func decodeCursor(cursor *string) (*key, error) {
+	if cursor == nil {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(*cursor)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid cursor")
+	}
+
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 2 {
+		return nil, apperrors.Invalid("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, apperrors.Invalid("invalid cursor")
+	}
+	id, err := uuid.FromString(parts[1])
+	if err != nil {
+		return nil, apperrors.Invalid("invalid cursor")
+	}
+
+	return &key{createdAt, id}, nil
+}
+
+type Page struct {
+	limit    int
+	backward bool
+	after    *key
+	before   *key
+}
+
+func NewPage(args Args) (*Page, error) {
+	if args.First != nil && args.Last != nil {
+		return nil, apperrors.Invalid("first and last can't be used together")
+	}
+
+	page := &Page{
+		limit:    DefaultPageSize,
+		backward: args.Last != nil,
+	}
+	if args.First != nil {
+		page.limit = *args.First
+	} else if args.Last != nil {
+		page.limit = *args.Last
+	}
+	if page.limit < 1 || page.limit > MaxPageSize() {
+		return nil, apperrors.Invalid("page size must be between 1 and " + strconv.Itoa(MaxPageSize()))
+	}
+
+	var err error
+	if page.after, err = decodeCursor(args.After); err != nil {
+		return nil, err
+	}
+	if page.before, err = decodeCursor(args.Before); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Keyset limits the query to rows of the table between the page's cursors
+func (page *Page) Keyset(db *gorm.DB, table string) *gorm.DB {
+	if page.after != nil {
+		db = db.Where("("+table+".created_at, "+table+".id) > (?, ?)", page.after.createdAt, page.after.id)
+	}
+	if page.before != nil {
+		db = db.Where("("+table+".created_at, "+table+".id) < (?, ?)", page.before.createdAt, page.before.id)
+	}
+	return db
+}
+
+// Order is the ORDER BY clause that walks the table's rows towards the page
+func (page *Page) Order(table string) string {
+	direction := " ASC"
+	if page.backward {
+		direction = " DESC"
+	}
+	return table + ".created_at" + direction + ", " + table + ".id" + direction
+}
+
+// Fetch is how many rows to load for the page. It's one more than the page holds, so Trim can tell whether there is another page.
+func (page *Page) Fetch() int {
+	return page.limit + 1
+}
+
+// Paginate applies the keyset conditions, ordering and limit for a page over the table's (created_at, id)
+func Paginate(db *gorm.DB, table string, args Args) (*gorm.DB, *Page, error) {
+	page, err := NewPage(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return page.Keyset(db, table).Order(page.Order(table)).Limit(page.Fetch()), page, nil
+}
+
+// Trim drops the extra row Paginate fetched from the slice rows points to, puts the rows back in ascending order and
+// reports which directions have more pages. Cursors are left for the caller to fill in from the edges.
+func (page *Page) Trim(rows interface{}) *model.PageInfo {
+	slice := reflect.ValueOf(rows).Elem()
+
+	more := slice.Len() > page.limit
+	if more {
+		slice.Set(slice.Slice(0, page.limit))
+	}
+
+	if page.backward {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+
+		return &model.PageInfo{
+			HasPreviousPage: more,
+			HasNextPage:     page.before != nil,
+		}
+	}
+
+	return &model.PageInfo{
+		HasNextPage:     more,
+		HasPreviousPage: page.after != nil,
+	}
+}
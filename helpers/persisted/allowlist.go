@@ -0,0 +1,53 @@
+package persisted
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/mitchellh/mapstructure"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errOperationNotAllowed = "OPERATION_NOT_ALLOWED"
+
+// Allowlist only runs operations registered at build time. Clients send the sha256 hash of a registered document
+// in the same persistedQuery extension automatic persisted queries use, and the query text is ignored.
+type Allowlist struct {
+	Operations map[string]string
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = Allowlist{}
+
+func (a Allowlist) ExtensionName() string {
+	return "Allowlist"
+}
+
+func (a Allowlist) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (a Allowlist) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	var extension struct {
+		Sha256 string `mapstructure:"sha256Hash"`
+	}
+
+	if rawParams.Extensions["persistedQuery"] != nil {
+		if err := mapstructure.Decode(rawParams.Extensions["persistedQuery"], &extension); err != nil {
+			return gqlerror.Errorf("invalid persisted query extension data")
+		}
+	}
+
+	document, ok := a.Operations[extension.Sha256]
+	if !ok {
+		err := gqlerror.Errorf("only registered operations are allowed")
+		errcode.Set(err, errOperationNotAllowed)
+		return err
+	}
+
+	rawParams.Query = document
+	return nil
+}
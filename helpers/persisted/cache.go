@@ -0,0 +1,94 @@
+package persisted
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+)
+
+const (
+	// MaxDocumentLength is the longest document the cache keeps. Longer ones still run, but are sent in full every time.
+	MaxDocumentLength = 32 << 10
+	// MaxUnused is how long a stored query lasts without being looked up. Clients send swept queries again in full.
+	MaxUnused = 30 * 24 * time.Hour
+)
+
+// Query is a persisted query document stored under its sha256 hash
+type Query struct {
+	Hash       string `gorm:"primary_key"`
+	Document   string `gorm:"type:text"`
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func (Query) TableName() string {
+	return "persisted_queries"
+}
+
+// PostgresCache shares automatic persisted queries between instances. Lookups go through the local cache first,
+// so the database is only hit the first time an instance sees a hash, which is also when a query counts as used.
+type PostgresCache struct {
+	DB    *gorm.DB
+	Local graphql.Cache
+}
+
+var _ graphql.Cache = PostgresCache{}
+
+func (c PostgresCache) Get(ctx context.Context, key string) (value interface{}, ok bool) {
+	if value, ok := c.Local.Get(ctx, key); ok {
+		return value, true
+	}
+
+	query := Query{}
+	if err := c.DB.Where(&Query{
+		Hash: key,
+	}).First(&query).Error; err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			logging.For(ctx).Error("loading persisted query failed", "error", err)
+		}
+		return nil, false
+	}
+
+	if err := c.DB.Model(&query).UpdateColumn("last_used_at", time.Now()).Error; err != nil {
+		logging.For(ctx).Error("marking persisted query used failed", "error", err)
+	}
+
+	c.Local.Add(ctx, key, query.Document)
+	return query.Document, true
+}
+
+// Add stores a document under its hash. Anyone can add queries, so long documents aren't kept.
+func (c PostgresCache) Add(ctx context.Context, key string, value interface{}) {
+	if document, ok := value.(string); !ok || len(document) > MaxDocumentLength {
+		return
+	}
+	c.Local.Add(ctx, key, value)
+
+	now := time.Now()
+	if err := c.DB.Exec(`INSERT INTO persisted_queries (hash, document, created_at, last_used_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (hash) DO UPDATE SET last_used_at = EXCLUDED.last_used_at`,
+		key, value, now, now,
+	).Error; err != nil {
+		logging.For(ctx).Error("storing persisted query failed", "error", err)
+	}
+}
+
+// Sweep deletes queries nobody has looked up for longer than maxUnused
+func (c PostgresCache) Sweep(maxUnused time.Duration) error {
+	return c.DB.Exec("DELETE FROM persisted_queries WHERE last_used_at < now() - ? * interval '1 second'", maxUnused.Seconds()).Error
+}
+
+// SweepEvery sweeps the stored queries every interval
+func (c PostgresCache) SweepEvery(interval time.Duration, maxUnused time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := c.Sweep(maxUnused); err != nil {
+			logging.For(context.Background()).Error("sweeping persisted queries failed", "error", err)
+		}
+	}
+}
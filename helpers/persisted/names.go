@@ -0,0 +1,33 @@
+package persisted
+
+import (
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+var (
+	namesOnce sync.Once
+	names     map[string]bool
+)
+
+// Registered reports whether name is the name of an operation in Operations. Clients choose operation names, so
+// anything keyed by them, like metric labels, should only trust registered ones.
+func Registered(name string) bool {
+	namesOnce.Do(func() {
+		names = map[string]bool{}
+		for _, document := range Operations {
+			doc, err := parser.ParseQuery(&ast.Source{Input: document})
+			if err != nil {
+				continue
+			}
+			for _, op := range doc.Operations {
+				if op.Name != "" {
+					names[op.Name] = true
+				}
+			}
+		}
+	})
+	return names[name]
+}
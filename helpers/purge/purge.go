@@ -0,0 +1,134 @@
+package purge
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+)
+
+var graceDays = 30
+
+func Configure(cfg config.Purge) {
+	graceDays = cfg.AfterDays
+}
+
+// GracePeriod is how long deleted users and events can be restored before they are purged
+func GracePeriod() time.Duration {
+	return time.Duration(graceDays) * 24 * time.Hour
+}
+
+func Restorable(deletedAt *time.Time) bool {
+	return deletedAt != nil && time.Since(*deletedAt) < GracePeriod()
+}
+
+// Every runs Expired on an interval for as long as the server is up
+func Every(interval time.Duration, db *gorm.DB) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := Expired(db); err != nil {
+			logging.For(context.Background()).Error("purging deleted records failed", "error", err)
+		}
+	}
+}
+
+// Expired hard deletes users, events and venues that were soft deleted longer ago than the grace period,
+// along with their attendance, notifications and uploaded files
+func Expired(db *gorm.DB) error {
+	cutoff := time.Now().Add(-GracePeriod())
+
+	var expiredUsers []*model.User
+	if err := db.Unscoped().Where("deleted_at < ?", cutoff).Find(&expiredUsers).Error; err != nil {
+		return err
+	}
+	for _, user := range expiredUsers {
+		if err := User(user, db); err != nil {
+			return err
+		}
+	}
+
+	var expiredEvents []*model.Event
+	if err := db.Unscoped().Where("deleted_at < ?", cutoff).Find(&expiredEvents).Error; err != nil {
+		return err
+	}
+	for _, event := range expiredEvents {
+		if err := Event(event, db); err != nil {
+			return err
+		}
+	}
+
+	//Events held at a venue keep the address they copied, the database only clears their venue
+	return db.Unscoped().Where("deleted_at < ?", cutoff).Delete(&model.Venue{}).Error
+}
+
+func Event(event *model.Event, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_events WHERE event_id = ?", event.UUIDKey.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(&model.Notification{
+			EventID: event.UUIDKey.ID,
+		}).Delete(&model.Notification{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&model.Event{
+			UUIDKey: event.UUIDKey,
+		}).Error
+	})
+}
+
+// User purges the user and every event and venue they own. Their profile picture is removed once the rows are gone.
+func User(user *model.User, db *gorm.DB) error {
+	var ownedEvents []*model.Event
+	if err := db.Unscoped().Where(&model.Event{
+		OwnerID: user.UUIDKey.ID,
+	}).Find(&ownedEvents).Error; err != nil {
+		return err
+	}
+	for _, event := range ownedEvents {
+		if err := Event(event, db); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_events WHERE user_id = ?", user.UUIDKey.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(&model.Notification{
+			UserID: user.UUIDKey.ID,
+		}).Delete(&model.Notification{}).Error; err != nil {
+			return err
+		}
+
+		//Soft deleted venues too, so none of theirs outlives them
+		if err := tx.Unscoped().Where(&model.Venue{
+			OwnerID: user.UUIDKey.ID,
+		}).Delete(&model.Venue{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&model.User{
+			UUIDKey: user.UUIDKey,
+		}).Error
+	}); err != nil {
+		return err
+	}
+
+	if user.ProfilePicturePath != "" {
+		if err := os.Remove(user.ProfilePicturePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
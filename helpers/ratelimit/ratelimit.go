@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var ipCtxKey = &contextKey{"ip"}
+
+type contextKey struct {
+	name string
+}
+
+// Middleware remembers the client's IP address for the limiter. X-Forwarded-For is only trusted when
+// trustProxy is set, since clients can send anything in it.
+func Middleware(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if forwarded := r.Header.Get("X-Forwarded-For"); trustProxy && forwarded != "" {
+				ip = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			}
+
+			ctx := context.WithValue(r.Context(), ipCtxKey, ip)
+
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func IPForContext(ctx context.Context) string {
+	raw, _ := ctx.Value(ipCtxKey).(string)
+	return raw
+}
+
+// Rules are the limits the limiter enforces. Every operation counts against the per-IP and per-user limits.
+// Root fields listed in Fields also get a bucket of their own per principal, which is the user when logged in
+// and the IP otherwise.
+type Rules struct {
+	IP     Limit
+	User   Limit
+	Fields map[string]Limit
+}
+
+// DefaultRules protect the expensive root fields: bcrypt at cost 14 on sign up and login, and geocoding
+// requests that spend our positionstack quota when events and venues are created or moved and addresses are looked up.
+// Address suggestions are requested as users type, so they get the most room.
+func DefaultRules() Rules {
+	return Rules{
+		IP:   Per(300, time.Minute),
+		User: Per(300, time.Minute),
+		Fields: map[string]Limit{
+			"createUser":         Per(5, time.Hour),
+			"login":              Per(10, time.Minute),
+			"restoreAccount":     Per(10, time.Minute),
+			"refreshToken":       Per(30, time.Minute),
+			"createEvent":        Per(20, time.Hour),
+			"updateEvent":        Per(60, time.Hour),
+			"createVenue":        Per(20, time.Hour),
+			"updateVenue":        Per(60, time.Hour),
+			"reverseGeocode":     Per(30, time.Minute),
+			"addressSuggestions": Per(120, time.Minute),
+		},
+	}
+}
+
+// Refill is the longest any of the rules' buckets takes to fill up from empty
+func (r Rules) Refill() time.Duration {
+	longest := r.IP.refill()
+	if refill := r.User.refill(); refill > longest {
+		longest = refill
+	}
+	for _, limit := range r.Fields {
+		if refill := limit.refill(); refill > longest {
+			longest = refill
+		}
+	}
+	return longest
+}
+
+// Limiter is a gqlgen extension that checks every operation against the rules once it has been parsed, so a
+// request that selects a limited field several times through aliases pays for each of them
+type Limiter struct {
+	Store Store
+	Rules Rules
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = Limiter{}
+
+func (l Limiter) ExtensionName() string {
+	return "RateLimit"
+}
+
+func (l Limiter) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l Limiter) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	ip := IPForContext(ctx)
+	principal := "ip:" + ip
+
+	if err := l.take(ctx, "ip:"+ip, l.Rules.IP, ""); err != nil {
+		return err
+	}
+	if user := auth.ForContext(ctx); user != nil {
+		principal = "user:" + user.UUIDKey.ID.String()
+		if err := l.take(ctx, principal, l.Rules.User, ""); err != nil {
+			return err
+		}
+	}
+
+	if rc.Operation == nil {
+		return nil
+	}
+	for _, field := range rootFields(rc.Operation.SelectionSet) {
+		limit, ok := l.Rules.Fields[field]
+		if !ok {
+			continue
+		}
+		if err := l.take(ctx, "field:"+field+":"+principal, limit, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l Limiter) take(ctx context.Context, key string, limit Limit, field string) *gqlerror.Error {
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	allowed, wait, err := l.Store.Take(ctx, key, limit)
+	if err != nil {
+		//Failing open keeps the API up when the limiter's backend is down
+		logging.For(ctx).Error("rate limiter failed", "error", err)
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	gqlErr := gqlerror.Errorf("too many requests, retry after %d seconds", retryAfter)
+	errcode.Set(gqlErr, apperrors.CodeRateLimited)
+	gqlErr.Extensions["retryAfter"] = retryAfter
+	if field != "" {
+		gqlErr.Extensions["field"] = field
+	}
+	return gqlErr
+}
+
+// rootFields lists the root fields an operation selects, following fragments
+func rootFields(selectionSet ast.SelectionSet) []string {
+	fields := []string{}
+
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, selection.Name)
+		case *ast.InlineFragment:
+			fields = append(fields, rootFields(selection.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				fields = append(fields, rootFields(selection.Definition.SelectionSet)...)
+			}
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+)
+
+// Limit is a token bucket that holds up to Burst tokens and refills at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// refill is how long an empty bucket takes to fill up
+func (l Limit) refill() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Per builds a limit allowing n requests per period, all of which can be spent at once
+func Per(n int, period time.Duration) Limit {
+	return Limit{
+		Rate:  float64(n) / period.Seconds(),
+		Burst: n,
+	}
+}
+
+// Store takes tokens from buckets. When a bucket is empty it reports how long until the next token is available.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+func retryAfter(tokens float64, limit Limit) time.Duration {
+	return time.Duration(math.Ceil((1-tokens)/limit.Rate*1000)) * time.Millisecond
+}
+
+// MemoryStore keeps buckets in this process. Use it for a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	s.takes++
+	if s.takes%10000 == 0 {
+		s.sweep(now)
+	}
+
+	if b.tokens < 1 {
+		return false, retryAfter(b.tokens, limit), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket starts out full anyway
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// PostgresStore keeps buckets in the database, so every instance behind a load balancer shares them
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+// Bucket is a row of the rate_limit_buckets table
+type Bucket struct {
+	Key       string `gorm:"primary_key"`
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+func (Bucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// Refilling, checking and taking a token happen in one statement, so concurrent requests can't overspend a bucket
+const takeSQL = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at) VALUES (?, ? - 1, true, now())
+ON CONFLICT (key) DO UPDATE SET
+	tokens = LEAST(?, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * ?)
+		- CASE WHEN LEAST(?, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * ?) >= 1 THEN 1 ELSE 0 END,
+	allowed = LEAST(?, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * ?) >= 1,
+	updated_at = now()
+RETURNING tokens, allowed`
+
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	burst := float64(limit.Burst)
+
+	var tokens float64
+	var allowed bool
+	if err := s.DB.Raw(takeSQL,
+		key, burst,
+		burst, limit.Rate,
+		burst, limit.Rate,
+		burst, limit.Rate,
+	).Row().Scan(&tokens, &allowed); err != nil {
+		return false, 0, err
+	}
+
+	if !allowed {
+		return false, retryAfter(tokens, limit), nil
+	}
+	return true, 0, nil
+}
+
+// Sweep deletes buckets nobody has taken from for longer than refill, the longest any limit takes to fill a bucket.
+// Those buckets are full again, and a new bucket starts out full anyway.
+func (s PostgresStore) Sweep(refill time.Duration) error {
+	return s.DB.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < now() - ? * interval '1 second'", refill.Seconds()).Error
+}
+
+// SweepEvery sweeps the buckets every interval
+func (s PostgresStore) SweepEvery(interval time.Duration, refill time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Sweep(refill); err != nil {
+			logging.For(context.Background()).Error("sweeping rate limit buckets failed", "error", err)
+		}
+	}
+}
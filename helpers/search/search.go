@@ -0,0 +1,148 @@
+package search
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	"github.com/opaquee/EventMapAPI/helpers/spatial"
+)
+
+const (
+	//Distance and time from now at which a match's text relevance is halved
+	distanceHalfKm = 25.0
+	timeHalfSecs   = 30 * 24 * 60 * 60
+
+	//Lower bound on trigram similarity for a misspelled name to still count as a match
+	minSimilarity = 0.3
+
+	//The description with HTML special characters escaped, so the only markup in a snippet is the highlighting
+	escapedDescription = `replace(replace(replace(replace(replace(events.description,
+		'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+)
+
+type Params struct {
+	Text     string
+	Near     *model.LocationInput
+	RadiusKm *float64
+	// IncludeOnline keeps online events in searches limited to a radius
+	IncludeOnline bool
+	From          *time.Time
+	To            *time.Time
+	CategoryIDs   []string
+	First         int
+	After         string
+}
+
+type Hit struct {
+	model.Event
+	Rank       float64
+	DistanceKm *float64
+	// Snippet is HTML: the escaped description around the matches, which are wrapped in <mark>
+	Snippet string
+}
+
+func EncodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("search:" + strconv.Itoa(offset)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), "search:") {
+		return 0, apperrors.Invalid("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(decoded), "search:"))
+	if err != nil || offset < 0 {
+		return 0, apperrors.Invalid("invalid cursor")
+	}
+	return offset, nil
+}
+
+// distanceSQL is the great-circle distance to an event, or NULL for online events, which are everywhere and nowhere
+func distanceSQL(near *model.LocationInput) (string, []interface{}) {
+	return `(CASE WHEN events.location_type = 'ONLINE' THEN NULL ELSE 6371 * acos(least(1.0,
+		cos(radians(?)) * cos(radians(events.latitude)) * cos(radians(events.longitude) - radians(?)) +
+		sin(radians(?)) * sin(radians(events.latitude)))) END)`,
+		[]interface{}{near.Latitude, near.Longitude, near.Latitude}
+}
+
+// Events runs a ranked full-text search over the events the query can see. Relevance comes from the search vector
+// and trigram similarity on the name, which keeps misspelled queries working, and decays with distance and with
+// how far the start date is from now. The returned offset is where the next page starts.
+func Events(db *gorm.DB, params Params) (hits []*Hit, offset int, hasNextPage bool, err error) {
+	text := strings.TrimSpace(params.Text)
+	if text == "" {
+		return nil, 0, false, apperrors.Validation(apperrors.Field("can't be empty", "query"))
+	}
+
+	if params.After != "" {
+		if offset, err = DecodeCursor(params.After); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	first := params.First
+	if first <= 0 {
+		first = pagination.DefaultPageSize
+	}
+	if first > pagination.MaxPageSize() {
+		return nil, 0, false, apperrors.Invalid("page size must be between 1 and " + strconv.Itoa(pagination.MaxPageSize()))
+	}
+
+	rank := `(ts_rank_cd(events.search_vector, websearch_to_tsquery('english', ?)) + similarity(events.name, ?)) *
+		(1.0 / (1.0 + abs(extract(epoch FROM events.start_date - now())) / ?))`
+	rankArgs := []interface{}{text, text, float64(timeHalfSecs)}
+
+	distance := "NULL::float"
+	var distanceArgs []interface{}
+	if params.Near != nil {
+		distance, distanceArgs = distanceSQL(params.Near)
+		rank += " * (1.0 / (1.0 + coalesce(" + distance + ", 0) / ?))"
+		rankArgs = append(append(rankArgs, distanceArgs...), distanceHalfKm)
+	}
+
+	selectArgs := append(rankArgs, distanceArgs...)
+	selectArgs = append(selectArgs, text)
+	query := db.Model(&model.Event{}).Select(`events.*,
+		`+rank+` AS rank,
+		`+distance+` AS distance_km,
+		ts_headline('english', `+escapedDescription+`, websearch_to_tsquery('english', ?),
+			'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet`,
+		selectArgs...,
+	).Where(`events.search_vector @@ websearch_to_tsquery('english', ?) OR similarity(events.name, ?) > ?`,
+		text, text, minSimilarity,
+	)
+
+	if params.Near != nil && params.RadiusKm != nil {
+		indexed, args := spatial.Within(params.Near.Latitude, params.Near.Longitude, *params.RadiusKm)
+		args = append(append(args, distanceArgs...), *params.RadiusKm)
+		query = events.Located(query, params.IncludeOnline, indexed+" AND "+distance+" <= ?", args...)
+	}
+	if params.From != nil {
+		query = query.Where("events.start_date >= ?", *params.From)
+	}
+	if params.To != nil {
+		query = query.Where("events.start_date <= ?", *params.To)
+	}
+	query, err = events.InCategories(query, params.CategoryIDs, "categories")
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if err := query.Order("rank DESC").Order("events.id").Offset(offset).Limit(first + 1).Scan(&hits).Error; err != nil {
+		return nil, 0, false, err
+	}
+
+	if len(hits) > first {
+		hits = hits[:first]
+		hasNextPage = true
+	}
+
+	return hits, offset, hasNextPage, nil
+}
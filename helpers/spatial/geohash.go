@@ -0,0 +1,104 @@
+package spatial
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+	// GeohashPrecision is the length of the geohashes stored on events, cells of about five by five meters
+	GeohashPrecision = 9
+
+	//Covers are kept to this many cells so queries don't grow a long list of prefixes
+	maxCoverCells = 32
+)
+
+// Encode computes the geohash of a point the same way the geohash_encode function in migration 6 does, so
+// prefixes computed here match the ones stored on events
+func Encode(latitude float64, longitude float64, precision int) string {
+	latMin, latMax := -90.0, 90.0
+	lngMin, lngMax := -180.0, 180.0
+	hash := strings.Builder{}
+	bits, code, even := 0, 0, true
+
+	for hash.Len() < precision {
+		if even {
+			mid := (lngMin + lngMax) / 2
+			if longitude >= mid {
+				code = code*2 + 1
+				lngMin = mid
+			} else {
+				code = code * 2
+				lngMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if latitude >= mid {
+				code = code*2 + 1
+				latMin = mid
+			} else {
+				code = code * 2
+				latMax = mid
+			}
+		}
+		even = !even
+		bits++
+		if bits == 5 {
+			hash.WriteByte(geohashAlphabet[code])
+			bits, code = 0, 0
+		}
+	}
+
+	return hash.String()
+}
+
+// cellSize is the height and width in degrees of the cells of geohashes with precision characters. Longitude gets
+// the extra bit when there's an odd number of them.
+func cellSize(precision int) (latDegrees float64, lngDegrees float64) {
+	bits := 5 * precision
+	return 180 / math.Pow(2, float64(bits/2)), 360 / math.Pow(2, float64(bits-bits/2))
+}
+
+// cellRange is the first and last cell a span of degrees touches, counting from min
+func cellRange(from float64, to float64, min float64, size float64, cells int) (int, int) {
+	first := int(math.Floor((from - min) / size))
+	last := int(math.Floor((to - min) / size))
+	return clamp(first, cells), clamp(last, cells)
+}
+
+func clamp(cell int, cells int) int {
+	if cell < 0 {
+		return 0
+	}
+	if cell >= cells {
+		return cells - 1
+	}
+	return cell
+}
+
+// Cover lists the geohash prefixes whose cells cover a box that doesn't cross the antimeridian, using the longest
+// prefixes that keep the list short. Boxes too big for that get nil, since an index wouldn't help with them anyway.
+func Cover(south float64, west float64, north float64, east float64) []string {
+	for precision := GeohashPrecision; precision > 1; precision-- {
+		latSize, lngSize := cellSize(precision)
+		latCells, lngCells := int(math.Round(180/latSize)), int(math.Round(360/lngSize))
+		firstRow, lastRow := cellRange(south, north, -90, latSize, latCells)
+		firstCol, lastCol := cellRange(west, east, -180, lngSize, lngCells)
+		if (lastRow-firstRow+1)*(lastCol-firstCol+1) > maxCoverCells {
+			continue
+		}
+
+		prefixes := []string{}
+		for row := firstRow; row <= lastRow; row++ {
+			for col := firstCol; col <= lastCol; col++ {
+				//Encoding the center of a cell gives the cell's own geohash
+				prefixes = append(prefixes, Encode(-90+(float64(row)+0.5)*latSize, -180+(float64(col)+0.5)*lngSize, precision))
+			}
+		}
+		return prefixes
+	}
+
+	return nil
+}
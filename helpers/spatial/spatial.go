@@ -0,0 +1,109 @@
+package spatial
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/helpers/config"
+)
+
+// Index is how location queries narrow down events before checking their exact coordinates
+type Index string
+
+const (
+	// PostGIS uses the location geography column and its GiST indexes
+	PostGIS Index = "postgis"
+	// Geohash range scans the geohash column's btree index, which works without any extension
+	Geohash Index = "geohash"
+)
+
+// kmPerDegree is the length of a degree of latitude, close enough everywhere for a bounding box
+const kmPerDegree = 111.2
+
+var index = Geohash
+
+// Configure picks the index location queries use. Migration 6 only adds the location column when PostGIS could be
+// installed, so auto uses PostGIS whenever the column is there.
+func Configure(db *gorm.DB, cfg config.Spatial) error {
+	hasLocation := db.Dialect().HasColumn("events", "location")
+
+	switch Index(cfg.Index) {
+	case PostGIS:
+		if !hasLocation {
+			return errors.New("SPATIAL_INDEX is postgis, but the events table has no location column. PostGIS has to be installable when migration 6 runs")
+		}
+		index = PostGIS
+	case Geohash:
+		index = Geohash
+	default:
+		index = Geohash
+		if hasLocation {
+			index = PostGIS
+		}
+	}
+
+	return nil
+}
+
+// Current is the index location queries use
+func Current() Index {
+	return index
+}
+
+// InBox is a condition that uses the spatial index to narrow events down to a box. A west edge greater than the
+// east edge means the box crosses the antimeridian. Geohash cells stick out of the box, so callers still check the
+// exact bounds.
+func InBox(south float64, west float64, north float64, east float64) (string, []interface{}) {
+	if west > east {
+		westWhere, westArgs := InBox(south, west, north, 180)
+		eastWhere, eastArgs := InBox(south, -180, north, east)
+		return "(" + westWhere + " OR " + eastWhere + ")", append(westArgs, eastArgs...)
+	}
+
+	if index == PostGIS {
+		return "events.location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326)", []interface{}{west, south, east, north}
+	}
+
+	prefixes := Cover(south, west, north, east)
+	if prefixes == nil {
+		return "events.geohash IS NOT NULL", nil
+	}
+	conditions := make([]string, len(prefixes))
+	args := make([]interface{}, len(prefixes))
+	for i, prefix := range prefixes {
+		conditions[i] = "events.geohash LIKE ?"
+		args[i] = prefix + "%"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// Within is a condition that uses the spatial index to narrow events down to those within radiusKm of a point.
+// Callers still check the great-circle distance.
+func Within(latitude float64, longitude float64, radiusKm float64) (string, []interface{}) {
+	if index == PostGIS {
+		//PostGIS's sphere is slightly bigger than ours, the padding keeps events right at the edge
+		return "ST_DWithin(events.location, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?, false)",
+			[]interface{}{longitude, latitude, radiusKm*1000 + 10}
+	}
+
+	latDelta := radiusKm / kmPerDegree
+	lngDelta := 180.0
+	if cos := math.Cos(latitude * math.Pi / 180); cos > 0.01 {
+		lngDelta = math.Min(180, latDelta/cos)
+	}
+
+	south, north := math.Max(-90, latitude-latDelta), math.Min(90, latitude+latDelta)
+	west, east := longitude-lngDelta, longitude+lngDelta
+	switch {
+	case lngDelta >= 180:
+		west, east = -180, 180
+	case west < -180:
+		west += 360
+	case east > 180:
+		east -= 360
+	}
+
+	return InBox(south, west, north, east)
+}
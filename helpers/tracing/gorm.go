@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "tracing:context"
+	spanKey    = "tracing:span"
+)
+
+// WithContext returns a handle on db whose queries are traced as children of the span in ctx. GORM v1 doesn't take
+// a context, so it's carried along as a setting instead.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// RegisterCallbacks adds a span for every create, query, update, delete and row query made through db
+func RegisterCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+
+	callbacks.Create().Before("gorm:begin_transaction").Register("tracing:before_create", start("create"))
+	callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after_create", end)
+	callbacks.Query().Before("gorm:query").Register("tracing:before_query", start("query"))
+	callbacks.Query().After("gorm:after_query").Register("tracing:after_query", end)
+	callbacks.Update().Before("gorm:begin_transaction").Register("tracing:before_update", start("update"))
+	callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after_update", end)
+	callbacks.Delete().Before("gorm:begin_transaction").Register("tracing:before_delete", start("delete"))
+	callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after_delete", end)
+	callbacks.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", start("row_query"))
+	callbacks.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", end)
+}
+
+func start(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		ctx := context.Background()
+		if value, ok := scope.Get(contextKey); ok {
+			ctx = value.(context.Context)
+		}
+
+		_, span := Tracer().Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.sql.table", scope.TableName()),
+		))
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+func end(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+
+	//Only the statement with its placeholders is recorded, never the values bound to it
+	span.SetAttributes(attribute.String("db.statement", scope.SQL))
+	if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+		span.RecordError(scope.DB().Error)
+		span.SetStatus(codes.Error, scope.DB().Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/opaquee/EventMapAPI/helpers/operation"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL is a gqlgen extension that adds a span for each operation and a child span for each resolver. A
+// subscription's span lasts until it ends.
+type GraphQL struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.FieldInterceptor
+} = GraphQL{}
+
+func (GraphQL) ExtensionName() string {
+	return "Tracing"
+}
+
+func (GraphQL) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (GraphQL) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	rc := graphql.GetOperationContext(ctx)
+
+	name, operationType := operation.Labels(rc)
+	ctx, span := Tracer().Start(ctx, "graphql."+operationType+" "+name, trace.WithAttributes(
+		attribute.String("graphql.operation.type", operationType),
+		attribute.String("graphql.operation.name", name),
+	))
+
+	responses := next(ctx)
+
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+
+		if response != nil && len(response.Errors) > 0 {
+			span.SetStatus(codes.Error, response.Errors.Error())
+		}
+		if response == nil || operationType != string(ast.Subscription) {
+			span.End()
+		}
+
+		return response
+	}
+}
+
+// InterceptField only traces fields backed by a method, the same ones metrics are kept for
+func (GraphQL) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsMethod {
+		return next(ctx)
+	}
+
+	ctx, span := Tracer().Start(ctx, fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	defer span.End()
+
+	res, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return res, err
+}
@@ -1,10 +1,9 @@
 package users
 
 import (
-	"errors"
-
 	"github.com/jinzhu/gorm"
 	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,6 +19,18 @@ func GetUserByUsername(username string, db *gorm.DB) (user *model.User, err erro
 	return user, nil
 }
 
+func GetDeletedUserByUsername(username string, db *gorm.DB) (user *model.User, err error) {
+	user = &model.User{}
+
+	if err := db.Unscoped().Where(&model.User{
+		Username: username,
+	}).Where("deleted_at IS NOT NULL").First(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
 func Authenticate(incomingUser *model.User, db *gorm.DB) (correct bool, err error) {
 	userFromDB := model.User{}
 
@@ -45,7 +56,8 @@ func CheckPasswordHash(password, hash string) bool {
 func Duplicate(incomingUser *model.User, db *gorm.DB) (err error) {
 	var user model.User
 
-	err = db.Where(model.User{
+	//Deleted accounts keep their username and email until they are purged, so they can still be restored
+	err = db.Unscoped().Where(model.User{
 		Username: incomingUser.Username,
 	}).Or(model.User{
 		Email: incomingUser.Email,
@@ -56,7 +68,7 @@ func Duplicate(incomingUser *model.User, db *gorm.DB) (err error) {
 	}
 
 	if gorm.IsRecordNotFoundError(err) == false {
-		return errors.New("username or email is duplicate")
+		return apperrors.Conflict("username or email is duplicate")
 	}
 
 	return nil
@@ -64,10 +76,10 @@ func Duplicate(incomingUser *model.User, db *gorm.DB) (err error) {
 
 func CheckAccess(userFromCtx *model.User, userFromDB *model.User) (err error) {
 	if userFromCtx == nil {
-		return errors.New("no user information from context. You probably didn't provide a token")
+		return apperrors.Unauthenticated()
 	}
 	if userFromCtx.UUIDKey.ID != userFromDB.UUIDKey.ID {
-		return errors.New("access denied")
+		return apperrors.Forbidden("access denied")
 	}
 	return nil
 }
@@ -77,8 +89,18 @@ func CheckEventOwner(userFromCtx *model.User, event *model.Event, db *gorm.DB) (
 		return err
 	}
 	if event.OwnerID != userFromCtx.UUIDKey.ID {
-		return errors.New("event does not belong to user")
+		return apperrors.Forbidden("event does not belong to user")
 	}
 
 	return nil
 }
+
+func CheckStaff(userFromCtx *model.User) (err error) {
+	if userFromCtx == nil {
+		return apperrors.Unauthenticated()
+	}
+	if !userFromCtx.IsStaff {
+		return apperrors.Forbidden("access denied, only staff can do this")
+	}
+	return nil
+}
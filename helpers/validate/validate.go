@@ -0,0 +1,232 @@
+package validate
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/address"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	"github.com/opaquee/EventMapAPI/helpers/events"
+)
+
+const (
+	MaxNameLength        = 50
+	MaxEmailLength       = 254
+	MinUsernameLength    = 3
+	MaxUsernameLength    = 30
+	MinPasswordLength    = 8
+	MaxEventNameLength   = 100
+	MaxDescriptionLength = 5000
+	MaxAddressLength     = 100
+	MaxTags              = 10
+	MaxTagLength         = 30
+	MaxVenueNameLength   = 100
+	MaxCapacity          = 1000000
+	MaxJoinURLLength     = 2000
+	// MaxPasswordBytes is as much of a password as bcrypt reads, anything longer would be silently ignored
+	MaxPasswordBytes = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Validator collects every problem with an input, so clients can fix them all at once
+type Validator struct {
+	fields []apperrors.FieldError
+}
+
+// Check records message against the input at path unless ok
+func (v *Validator) Check(ok bool, message string, path ...string) {
+	if !ok {
+		v.fields = append(v.fields, apperrors.Field(message, path...))
+	}
+}
+
+// Err returns a validation error listing every failed check, or nil if they all passed
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return apperrors.Validation(v.fields...)
+}
+
+// Length checks that s has between min and max characters, ignoring surrounding whitespace
+func (v *Validator) Length(s string, min int, max int, path ...string) {
+	length := utf8.RuneCountInString(strings.TrimSpace(s))
+	switch {
+	case min > 0 && length == 0:
+		v.Check(false, "can't be empty", path...)
+	case length < min:
+		v.Check(false, "must be at least "+strconv.Itoa(min)+" characters", path...)
+	case length > max:
+		v.Check(false, "must be at most "+strconv.Itoa(max)+" characters", path...)
+	}
+}
+
+// Name checks a person's name. Names end up in calendar feeds, where a line break would start a new property.
+func (v *Validator) Name(name string, path ...string) {
+	v.Length(name, 1, MaxNameLength, path...)
+	v.Check(strings.IndexFunc(name, unicode.IsControl) < 0, "can't contain control characters", path...)
+}
+
+func (v *Validator) Email(email string, path ...string) {
+	address, err := mail.ParseAddress(email)
+	valid := err == nil && address.Address == email && len(email) <= MaxEmailLength
+	//Addresses like user@localhost parse, but can't receive mail from us
+	valid = valid && strings.Contains(email[strings.LastIndex(email, "@"):], ".")
+	v.Check(valid, "must be a valid email address", path...)
+}
+
+func (v *Validator) Username(username string, path ...string) {
+	v.Length(username, MinUsernameLength, MaxUsernameLength, path...)
+	v.Check(username == "" || usernamePattern.MatchString(username), "can only contain letters, numbers, dots, dashes and underscores", path...)
+}
+
+// Password requires a letter and a number in passwords long enough to be worth hashing and short enough for bcrypt
+func (v *Validator) Password(password string, path ...string) {
+	var letter, number bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		number = number || unicode.IsDigit(r)
+	}
+
+	switch {
+	case utf8.RuneCountInString(password) < MinPasswordLength:
+		v.Check(false, "must be at least "+strconv.Itoa(MinPasswordLength)+" characters", path...)
+	case len(password) > MaxPasswordBytes:
+		v.Check(false, "must be at most "+strconv.Itoa(MaxPasswordBytes)+" bytes", path...)
+	case !letter || !number:
+		v.Check(false, "must contain a letter and a number", path...)
+	}
+}
+
+// Address checks a normalized address against its country's rules
+func (v *Validator) Address(postalAddress model.PostalAddress, path ...string) {
+	for _, problem := range address.Check(postalAddress) {
+		v.Check(false, problem.Message, append(append([]string{}, path...), problem.Path...)...)
+	}
+}
+
+// Zip checks for a five digit US zip code. Zip arguments are ints, so ones with leading zeros like 02134 arrive as 2134.
+func (v *Validator) Zip(zip int, path ...string) {
+	v.Check(zip >= 501 && zip <= 99950, "must be a five digit zip code", path...)
+}
+
+// Location checks that a point is on the map
+func (v *Validator) Location(location model.LocationInput, path ...string) {
+	v.Check(location.Latitude >= -90 && location.Latitude <= 90, "must be between -90 and 90", append(append([]string{}, path...), "latitude")...)
+	v.Check(location.Longitude >= -180 && location.Longitude <= 180, "must be between -180 and 180", append(append([]string{}, path...), "longitude")...)
+}
+
+func NewUser(input model.NewUser) error {
+	v := &Validator{}
+	v.Name(input.FirstName, "input", "firstName")
+	v.Name(input.LastName, "input", "lastName")
+	v.Email(input.Email, "input", "email")
+	v.Username(input.Username, "input", "username")
+	v.Password(input.Password, "input", "password")
+	return v.Err()
+}
+
+func UpdateUser(input model.UpdateUserInput) error {
+	v := &Validator{}
+	v.Name(input.FirstName, "input", "firstName")
+	v.Name(input.LastName, "input", "lastName")
+	v.Email(input.Email, "input", "email")
+	return v.Err()
+}
+
+func NewEvent(input model.NewEvent) error {
+	v := &Validator{}
+	v.Length(input.Name, 1, MaxEventNameLength, "input", "name")
+	v.Length(input.Description, 0, MaxDescriptionLength, "input", "description")
+	v.joinURL(input)
+	switch {
+	case !events.Physical(input):
+		v.Check(input.VenueID == nil && input.Address == nil && input.Location == nil && !events.UsesLegacyAddress(input), "online events can't have an address or venue", "input", "locationType")
+	case input.VenueID != nil:
+		v.Check(input.Address == nil && input.Location == nil && !events.UsesLegacyAddress(input), "can't be combined with an address", "input", "venueId")
+	case input.Location != nil:
+		v.Check(input.Address == nil && !events.UsesLegacyAddress(input), "can't be combined with an address", "input", "location")
+		v.Location(*input.Location, "input", "location")
+	case input.Address != nil:
+		v.Check(!events.UsesLegacyAddress(input), "can't be combined with addressLine1, addressLine2, city, state or zip", "input", "address")
+		v.Address(events.Address(input), "input", "address")
+	default:
+		v.legacyAddress(input)
+	}
+	if input.StartDate != nil && input.EndDate != nil {
+		v.Check(!input.EndDate.Before(*input.StartDate), "can't be before startDate", "input", "endDate")
+	}
+	v.Check(len(input.Tags) <= MaxTags, "can have at most "+strconv.Itoa(MaxTags)+" tags", "input", "tags")
+	for i, tag := range input.Tags {
+		v.Length(tag, 0, MaxTagLength, "input", "tags", strconv.Itoa(i))
+	}
+	return v.Err()
+}
+
+func NewVenue(input model.NewVenue) error {
+	v := &Validator{}
+	v.Length(input.Name, 1, MaxVenueNameLength, "input", "name")
+	v.Address(address.FromInput(*input.Address), "input", "address")
+	if input.Capacity != nil {
+		v.Check(*input.Capacity >= 1 && *input.Capacity <= MaxCapacity, "must be between 1 and "+strconv.Itoa(MaxCapacity), "input", "capacity")
+	}
+	if input.AccessibilityNotes != nil {
+		v.Length(*input.AccessibilityNotes, 0, MaxDescriptionLength, "input", "accessibilityNotes")
+	}
+	return v.Err()
+}
+
+// URL checks for an absolute http or https link
+func (v *Validator) URL(link string, path ...string) {
+	parsed, err := url.Parse(link)
+	valid := err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+	v.Check(valid, "must be an http or https link", path...)
+	v.Check(len(link) <= MaxJoinURLLength, "must be at most "+strconv.Itoa(MaxJoinURLLength)+" characters", path...)
+}
+
+// joinURL requires a join link for events attended online and rejects one for events held only in person
+func (v *Validator) joinURL(input model.NewEvent) {
+	joinURL := events.JoinURL(input)
+	switch events.LocationType(input) {
+	case model.LocationTypeInPerson:
+		v.Check(joinURL == "", "can only be set on online and hybrid events", "input", "joinUrl")
+	case model.LocationTypeOnline, model.LocationTypeHybrid:
+		if joinURL == "" {
+			v.Check(false, "is required for online and hybrid events", "input", "joinUrl")
+		} else {
+			v.URL(joinURL, "input", "joinUrl")
+		}
+	}
+}
+
+// legacyAddress checks the deprecated address fields, which only take US addresses
+func (v *Validator) legacyAddress(input model.NewEvent) {
+	required := func(s *string, path ...string) {
+		if s == nil {
+			v.Check(false, "is required without an address", path...)
+		} else {
+			v.Length(*s, 1, MaxAddressLength, path...)
+		}
+	}
+	required(input.AddressLine1, "input", "addressLine1")
+	if input.AddressLine2 != nil {
+		v.Length(*input.AddressLine2, 0, MaxAddressLength, "input", "addressLine2")
+	}
+	required(input.City, "input", "city")
+	required(input.State, "input", "state")
+	if input.State != nil {
+		v.Check(address.Countries["US"].Regions[events.Address(input).Region], "must be a two letter state code like CA", "input", "state")
+	}
+	if input.Zip == nil {
+		v.Check(false, "is required without an address", "input", "zip")
+	} else {
+		v.Zip(*input.Zip, "input", "zip")
+	}
+}
@@ -0,0 +1,141 @@
+package venues
+
+import (
+	"math"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opaquee/EventMapAPI/graph/model"
+	"github.com/opaquee/EventMapAPI/helpers/apperrors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	DefaultRadiusKm = 10.0
+	MaxRadiusKm     = 500
+)
+
+// kmPerDegree is the length of a degree of latitude, close enough everywhere for a bounding box
+const kmPerDegree = 111.2
+
+func GetVenueByID(venueID string, db *gorm.DB) (*model.Venue, error) {
+	id, err := uuid.FromString(venueID)
+	if err != nil {
+		return nil, apperrors.Validation(apperrors.Field("isn't a valid id", "venueId"))
+	}
+	venue := &model.Venue{
+		UUIDKey: model.UUIDKey{
+			ID: id,
+		},
+	}
+
+	if err := db.Where(venue).First(venue).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, apperrors.NotFound("venue")
+		}
+		return nil, err
+	}
+
+	return venue, nil
+}
+
+// CheckOwner allows a venue's owner and staff to change it
+func CheckOwner(userFromCtx *model.User, venue *model.Venue) error {
+	if userFromCtx == nil {
+		return apperrors.Unauthenticated()
+	}
+	if userFromCtx.UUIDKey.ID != venue.OwnerID && !userFromCtx.IsStaff {
+		return apperrors.Forbidden("venue does not belong to user")
+	}
+	return nil
+}
+
+// Near finds the venues within radiusKm of a point, closest first. A bounding box narrows the rows before the
+// great-circle distance is worked out for each of them.
+func Near(db *gorm.DB, near model.LocationInput, radiusKm float64, limit int) ([]*model.Venue, error) {
+	latDelta := radiusKm / kmPerDegree
+	lngDelta := 180.0
+	if cos := math.Cos(near.Latitude * math.Pi / 180); cos > 0.01 {
+		lngDelta = math.Min(180, latDelta/cos)
+	}
+
+	distance := `(6371 * acos(least(1.0,
+		cos(radians(?)) * cos(radians(venues.latitude)) * cos(radians(venues.longitude) - radians(?)) +
+		sin(radians(?)) * sin(radians(venues.latitude)))))`
+	distanceArgs := []interface{}{near.Latitude, near.Longitude, near.Latitude}
+
+	query := db.Where("venues.latitude BETWEEN ? AND ?", near.Latitude-latDelta, near.Latitude+latDelta)
+	//Boxes crossing the antimeridian wrap around to the other side of the map
+	west, east := near.Longitude-lngDelta, near.Longitude+lngDelta
+	switch {
+	case lngDelta >= 180:
+	case west < -180:
+		query = query.Where("venues.longitude >= ? OR venues.longitude <= ?", west+360, east)
+	case east > 180:
+		query = query.Where("venues.longitude >= ? OR venues.longitude <= ?", west, east-360)
+	default:
+		query = query.Where("venues.longitude BETWEEN ? AND ?", west, east)
+	}
+
+	var venues []*model.Venue
+	err := query.Where(distance+" <= ?", append(distanceArgs, radiusKm)...).
+		Order(gorm.Expr(distance, distanceArgs...)).
+		Limit(limit).
+		Find(&venues).Error
+
+	return venues, err
+}
+
+// Apply copies a venue's address and coordinates onto an event held there
+func Apply(event *model.Event, venue *model.Venue) {
+	event.VenueID = &venue.UUIDKey.ID
+	event.Address = venue.Address
+	event.Latitude = venue.Latitude
+	event.Longitude = venue.Longitude
+}
+
+// Moved updates the address of the events at a venue whose address changed. Completed events stay where they
+// were held.
+func Moved(venue *model.Venue, db *gorm.DB) error {
+	return db.Model(&model.Event{}).
+		Where("venue_id = ? AND status <> ?", venue.UUIDKey.ID, model.EventStatusCompleted).
+		UpdateColumns(map[string]interface{}{
+			"address_country_code": venue.Address.CountryCode,
+			"address_postal_code":  venue.Address.PostalCode,
+			"address_region":       venue.Address.Region,
+			"address_locality":     venue.Address.Locality,
+			"address_lines":        venue.Address.Lines,
+			"latitude":             venue.Latitude,
+			"longitude":            venue.Longitude,
+		}).Error
+}
+
+// Group collects events held at the same venue into one spot on the map. Events without a venue are spots of their own.
+func Group(events []*model.Event) []*model.EventGroup {
+	groups := []*model.EventGroup{}
+	byVenue := map[uuid.UUID]*model.EventGroup{}
+
+	for _, event := range events {
+		if event.VenueID == nil {
+			groups = append(groups, &model.EventGroup{
+				Latitude:  event.Latitude,
+				Longitude: event.Longitude,
+				Events:    []*model.Event{event},
+			})
+			continue
+		}
+
+		group, ok := byVenue[*event.VenueID]
+		if !ok {
+			group = &model.EventGroup{
+				VenueID:   event.VenueID,
+				Latitude:  event.Latitude,
+				Longitude: event.Longitude,
+			}
+			byVenue[*event.VenueID] = group
+			groups = append(groups, group)
+		}
+		group.Events = append(group.Events, event)
+	}
+
+	return groups
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opaquee/EventMapAPI/helpers/config"
+	"github.com/opaquee/EventMapAPI/helpers/dbconn"
+	"github.com/opaquee/EventMapAPI/helpers/migrate"
+)
+
+const migrateUsage = `usage:
+  main migrate up [flags]           apply every pending migration
+  main migrate down [steps] [flags] roll back the newest applied migrations, one by default
+  main migrate status [flags]       list migrations and when they were applied
+  main migrate create NAME          add empty up and down files to ` + migrate.Dir
+
+// migrateCommand runs the migrate subcommand. Flags after the command are the same as the server's.
+func migrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+	command, args := args[0], args[1:]
+
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatal(migrateUsage)
+		}
+		created, err := migrate.Create(migrate.Dir, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, path := range created {
+			log.Println("Created", path)
+		}
+		return
+	}
+
+	steps := 1
+	if command == "down" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 1 {
+			log.Fatal("steps must be a positive number")
+		}
+		steps, args = parsed, args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := dbconn.Connect(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		ran, err := migrate.Up(db)
+		for _, migration := range ran {
+			log.Printf("Applied %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			log.Println("Schema is up to date")
+		}
+	case "down":
+		reverted, err := migrate.Down(db, steps)
+		for _, migration := range reverted {
+			log.Printf("Reverted %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			log.Println("No migrations to roll back")
+		}
+	case "status":
+		statuses, err := migrate.Statuses(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		out.Flush()
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/go-chi/chi"
@@ -18,47 +22,107 @@ import (
 	"github.com/opaquee/EventMapAPI/graph/generated"
 	"github.com/opaquee/EventMapAPI/graph/model"
 	"github.com/opaquee/EventMapAPI/helpers/auth"
+	"github.com/opaquee/EventMapAPI/helpers/complexity"
+	"github.com/opaquee/EventMapAPI/helpers/config"
 	"github.com/opaquee/EventMapAPI/helpers/dbconn"
+	"github.com/opaquee/EventMapAPI/helpers/drain"
+	"github.com/opaquee/EventMapAPI/helpers/feeds"
+	"github.com/opaquee/EventMapAPI/helpers/file"
+	"github.com/opaquee/EventMapAPI/helpers/geocode"
+	"github.com/opaquee/EventMapAPI/helpers/health"
+	"github.com/opaquee/EventMapAPI/helpers/jwt"
+	"github.com/opaquee/EventMapAPI/helpers/loaders"
+	"github.com/opaquee/EventMapAPI/helpers/logging"
+	"github.com/opaquee/EventMapAPI/helpers/metrics"
+	"github.com/opaquee/EventMapAPI/helpers/migrate"
+	"github.com/opaquee/EventMapAPI/helpers/pagination"
+	"github.com/opaquee/EventMapAPI/helpers/persisted"
+	"github.com/opaquee/EventMapAPI/helpers/purge"
+	"github.com/opaquee/EventMapAPI/helpers/ratelimit"
+	"github.com/opaquee/EventMapAPI/helpers/spatial"
+	"github.com/opaquee/EventMapAPI/helpers/tracing"
 )
 
 var db *gorm.DB
 
-const defaultPort = "8080"
+const readinessTimeout = 2 * time.Second
 
 func main() {
-	time.Sleep(10 * time.Second)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logging.Setup(cfg.Environment, cfg.LogLevel)
+
+	jwt.Configure(cfg.JWT)
+	geocode.Configure(cfg.Geocoder)
+	file.Configure(cfg.Uploads)
+	purge.Configure(cfg.Purge)
+	pagination.Configure(cfg.Pagination)
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	log.Println("Connecting to database...")
-	db, err := dbconn.Open()
-	defer db.Close()
+	db, err := dbconn.Connect(cfg.Database)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
+	defer db.Close()
+	metrics.RegisterCallbacks(db)
+	tracing.RegisterCallbacks(db)
 
-	log.Println("Migrating tables...")
-	if err := db.AutoMigrate(&model.User{}, &model.Event{}).Error; err != nil {
-		panic(err)
+	log.Println("Checking schema version...")
+	if err := migrate.Check(db); err != nil {
+		log.Fatal(err)
 	}
-	if err := db.Model(&model.Event{}).AddForeignKey("owner_id", "users(id)", "CASCADE", "CASCADE").Error; err != nil {
-		panic(err)
+	if err := spatial.Configure(db, cfg.Spatial); err != nil {
+		log.Fatal(err)
 	}
+	log.Printf("Finding events by location with the %s index", spatial.Current())
 
 	log.Println("Starting server. Hold on to your potatoes!")
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
-	}
+	port := cfg.Port
 
 	log.Println("Applying middleware...")
 	router := chi.NewRouter()
+	drainer := drain.New()
+	router.Use(tracing.Middleware)
+	router.Use(logging.RequestID)
+	router.Use(drainer.Middleware)
+	router.Use(ratelimit.Middleware(cfg.RateLimit.TrustProxyHeaders))
 	router.Use(auth.Middleware(db))
+	router.Use(logging.Principal)
+
+	observers := make(map[string](map[string]chan *model.Event), 1)
+	notificationObservers := make(map[string](map[string]chan *model.Notification), 1)
+
+	resolver := &graph.Resolver{
+		DB:                    db,
+		Observers:             observers,
+		NotificationObservers: notificationObservers,
+	}
+
+	log.Println("Starting event completion job...")
+	go resolver.CompleteEvents(cfg.JobInterval)
+
+	log.Println("Starting purge job...")
+	go purge.Every(cfg.Purge.Interval, db)
 
-	observers := make(map[int](map[string]chan *model.Event), 1)
+	schemaConfig := generated.Config{Resolvers: resolver}
+	complexity.Configure(&schemaConfig.Complexity)
 
-	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{
-		DB:        db,
-		Observers: observers,
-	}}))
+	srv := handler.New(generated.NewExecutableSchema(schemaConfig))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.SetRecoverFunc(graph.Recover)
 
 	srv.AddTransport(transport.Websocket{
 		KeepAlivePingInterval: 10 * time.Second,
@@ -72,10 +136,88 @@ func main() {
 	srv.AddTransport(transport.MultipartForm{})
 
 	srv.Use(extension.Introspection{})
+	srv.Use(metrics.Tracer{})
+	srv.Use(tracing.GraphQL{})
+	srv.Use(logging.AccessLog{})
+	srv.Use(loaders.Extension{DB: db})
+
+	rateLimitRules := ratelimit.DefaultRules()
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Backend == "postgres" {
+		postgresStore := ratelimit.PostgresStore{DB: db}
+		go postgresStore.SweepEvery(time.Minute, rateLimitRules.Refill())
+		rateLimitStore = postgresStore
+	}
+	srv.Use(ratelimit.Limiter{
+		Store: rateLimitStore,
+		Rules: rateLimitRules,
+	})
+
+	if cfg.APQ.PersistedOnly {
+		log.Println("Only accepting registered operations...")
+		srv.Use(persisted.Allowlist{Operations: persisted.Operations})
+	} else if cfg.APQ.Cache == "postgres" {
+		apqCache := persisted.PostgresCache{
+			DB:    db,
+			Local: lru.New(cfg.APQ.CacheSize),
+		}
+		go apqCache.SweepEvery(time.Hour, persisted.MaxUnused)
+		srv.Use(extension.AutomaticPersistedQuery{Cache: apqCache})
+	} else {
+		srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New(cfg.APQ.CacheSize)})
+	}
+
+	srv.Use(complexity.DepthLimit{Limit: cfg.Complexity.MaxDepth})
+	srv.Use(complexity.Budget(cfg.Complexity))
+
+	router.Handle("/metrics", metrics.Handler())
+	router.Get("/healthz", health.Live)
+	router.Handle("/readyz", health.Ready{
+		Checks: map[string]health.Check{
+			"database": health.Database(db),
+			"geocoder": geocode.Ready,
+			"broker":   resolver.BrokerReady,
+			"shutdown": drainer.Ready,
+		},
+		Timeout: readinessTimeout,
+	})
+
+	router.Get("/events.geojson", feeds.GeoJSON(db))
+	router.Get("/tiles/{z}/{x}/{y}.mvt", feeds.Tile(db))
+	router.Get("/events/{id}.ics", feeds.Event(db))
+	router.Get("/calendar/{token}.ics", feeds.UserCalendar(db))
+	router.Get("/calendar/zip/{zip}.ics", feeds.ZipCalendar(db))
 
 	router.Handle("/", playground.Handler("GraphQL playground", "/query"))
 	router.Handle("/query", srv)
 
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	//Subscribers are told to reconnect first, since the server stops waiting on their connections once it's shut down.
+	//The database is closed by the deferred call after in-flight requests finish.
+	log.Println("Shutting down, closing subscriptions...")
+	drainer.Drain()
+
+	log.Println("Waiting for in-flight requests...")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logging.For(ctx).Error("requests were still running after the drain timeout", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logging.For(ctx).Error("flushing traces failed", "error", err)
+	}
 }